@@ -0,0 +1,130 @@
+package mecachis
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Admission decides whether a new key taking size bytes gets into a cache
+// holding up to capacity bytes, zero meaning unbounded. Returns why not,
+// usually *ErrTooLarge or *ErrNotAdmitted. Caches consult it with their lock
+// held, but the shards of a cache share it, hence it must be safe for
+// concurrent use. Keys being replaced are not subject to admission
+type Admission interface {
+	Admit(key string, size, capacity uint64) error
+}
+
+// isRejected tells whether the error comes from admission, which rejects
+// new keys as either too large or not admitted
+func isRejected(err error) bool {
+	switch err.(type) {
+	case *ErrTooLarge, *ErrNotAdmitted:
+		return true
+	}
+	return false
+}
+
+type sizeAdmission struct {
+	fraction float64
+}
+
+// NewSizeAdmission rejects keys larger than the fraction of the capacity,
+// which keeps a single key from flushing most of the cache
+func NewSizeAdmission(fraction float64) Admission {
+	return &sizeAdmission{fraction: fraction}
+}
+
+func (a *sizeAdmission) Admit(key string, size, capacity uint64) error {
+	if capacity == 0 || a.fraction <= 0 {
+		return nil
+	}
+	limit := uint64(float64(capacity) * a.fraction)
+	if size > limit {
+		return NewTooLargeError("'"+key+"'", limit)
+	}
+	return nil
+}
+
+type probabilisticAdmission struct {
+	probability float64
+}
+
+// NewProbabilisticAdmission admits new keys with the given probability, so
+// that keys written often get in sooner or later while scans of keys written
+// once barely disturb the cache
+func NewProbabilisticAdmission(probability float64) Admission {
+	return &probabilisticAdmission{probability: probability}
+}
+
+func (a *probabilisticAdmission) Admit(key string, size, capacity uint64) error {
+	// The top-level source of math/rand is safe for concurrent use
+	if rand.Float64() >= a.probability {
+		return NewNotAdmittedError(key, "not drawn")
+	}
+	return nil
+}
+
+// doorkeeper remembers the keys seen in a bloom filter, so that a key is
+// only admitted the second time it is written. One-hit wonders hence never
+// evict anything. The filter is cleared once as many keys as it was sized
+// for have been recorded, so that it does not saturate
+type doorkeeper struct {
+	mx     sync.Mutex
+	bits   []uint64
+	hashes uint64
+	keys   uint64
+	// how many keys were recorded since the last clear
+	recorded uint64
+}
+
+// NewDoorkeeper returns a doorkeeper sized for keys distinct keys with a
+// false positive rate of 1%
+func NewDoorkeeper(keys uint64) Admission {
+	if keys < 1 {
+		keys = 1
+	}
+	// m = -n·ln(p) / ln(2)² bits and k = m/n·ln(2) hashes
+	m := uint64(math.Ceil(-float64(keys) * math.Log(0.01) / (math.Ln2 * math.Ln2)))
+	return &doorkeeper{
+		bits:   make([]uint64, (m+63)/64),
+		hashes: uint64(math.Ceil(float64(m) / float64(keys) * math.Ln2)),
+		keys:   keys,
+	}
+}
+
+func (d *doorkeeper) Admit(key string, size, capacity uint64) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if d.record(key) {
+		return nil
+	}
+	d.recorded++
+	if d.recorded >= d.keys {
+		for i := range d.bits {
+			d.bits[i] = 0
+		}
+		d.recorded = 0
+	}
+	return NewNotAdmittedError(key, "first seen")
+}
+
+// record sets the bits of the key, returning whether they were all set
+// already. The bits are derived from two halves of a single hash
+func (d *doorkeeper) record(key string) bool {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32
+	m := uint64(len(d.bits)) * 64
+	seen := true
+	for i := uint64(0); i < d.hashes; i++ {
+		bit := (h1 + i*h2) % m
+		if d.bits[bit/64]&(1<<(bit%64)) == 0 {
+			seen = false
+			d.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return seen
+}
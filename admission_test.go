@@ -0,0 +1,103 @@
+package mecachis
+
+import (
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCache_Admission_Oversized(t *testing.T) {
+	c := NewCache(8, engines.LRU)
+	_ = c.Add("a", MemoryView("1"))
+	err := c.Add("b", MemoryView("0123456789"))
+	if _, ok := err.(*ErrTooLarge); !ok {
+		t.Errorf("unexpected error. want ErrTooLarge, have %v", err)
+	}
+	// The previous value is kept when the new one is rejected
+	err = c.Set("a", MemoryView("0123456789"))
+	if _, ok := err.(*ErrTooLarge); !ok {
+		t.Errorf("unexpected error. want ErrTooLarge, have %v", err)
+	}
+	if value, ok := c.Get("a"); !ok || value.String() != "1" {
+		t.Errorf("unexpected cache result. want '1', have '%s'", value.String())
+	}
+}
+
+func TestCache_Admission_Size(t *testing.T) {
+	c := NewCache(16, engines.LRU, WithAdmission(NewSizeAdmission(0.5)))
+	if err := c.Add("a", MemoryView("1234567")); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+	err := c.Add("b", MemoryView("12345678"))
+	if _, ok := err.(*ErrTooLarge); !ok {
+		t.Errorf("unexpected error. want ErrTooLarge, have %v", err)
+	}
+}
+
+func TestCache_Admission_Probabilistic(t *testing.T) {
+	c := NewCache(0, engines.LRU, WithAdmission(NewProbabilisticAdmission(0)))
+	err := c.Add("a", MemoryView("1"))
+	if _, ok := err.(*ErrNotAdmitted); !ok {
+		t.Errorf("unexpected error. want ErrNotAdmitted, have %v", err)
+	}
+	c = NewCache(0, engines.LRU, WithAdmission(NewProbabilisticAdmission(1)))
+	if err := c.Add("a", MemoryView("1")); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+}
+
+func TestCache_Admission_Doorkeeper(t *testing.T) {
+	c := NewShardedCache(0, engines.LRU, 4, WithAdmission(NewDoorkeeper(100)))
+	err := c.Add("a", MemoryView("1"))
+	if _, ok := err.(*ErrNotAdmitted); !ok {
+		t.Errorf("unexpected error. want ErrNotAdmitted, have %v", err)
+	}
+	if err := c.Add("a", MemoryView("1")); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+	// Keys cached already are replaced without going through admission
+	if err := c.Set("a", MemoryView("2")); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+}
+
+func TestDoorkeeper_Clears(t *testing.T) {
+	d := NewDoorkeeper(2)
+	for _, key := range []string{"a", "b", "a"} {
+		if err := d.Admit(key, 1, 0); err == nil {
+			t.Errorf("unexpected admission of '%s'. expected the filter to be cleared", key)
+		}
+	}
+	if err := d.Admit("a", 1, 0); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+}
+
+func TestReadAdmission_BoundsDoorkeeper(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/mecachis/pages?doorkeeper=1000000000000", nil)
+	policies := readAdmission(r, 1024)
+	if len(policies) != 1 {
+		t.Fatalf("unexpected policies. want 1, have %d", len(policies))
+	}
+	if have := policies[0].(*doorkeeper).keys; have != 128 {
+		t.Errorf("unexpected doorkeeper keys. want 128, have %d", have)
+	}
+}
+
+func TestHub_ServeHTTP_Admission(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPut, "/mecachis/pages?cap=64&doorkeeper=100", "", nil)
+	wants := []int{http.StatusInsufficientStorage, http.StatusCreated}
+	for _, want := range wants {
+		recorder := conditionalRequest(hub, http.MethodPost, "/mecachis/pages/home", "<html>", nil)
+		if recorder.Code != want {
+			t.Errorf("unexpected status code. want %d, have %d", want, recorder.Code)
+		}
+	}
+	recorder := conditionalRequest(hub, http.MethodPut, "/mecachis/pages/about", strings.Repeat("x", 64), nil)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+}
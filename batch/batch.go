@@ -0,0 +1,161 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ContentType identifies bodies framed by this package
+const ContentType = "application/x-mecachis-batch"
+
+// ErrTruncated is returned when a body ends in the middle of a frame
+var ErrTruncated = errors.New("batch: truncated frame")
+
+// Pair is a key-value pair as sent to the multi-set endpoint
+type Pair struct {
+	Key   string
+	Value []byte
+}
+
+// Result is the per-key outcome of a batch operation. Status holds an HTTP
+// status code, e.g. 200 or 404 for reads and 201 or 409 for writes. Value
+// is only set for successful reads
+type Result struct {
+	Status int
+	Value  []byte
+}
+
+// Every frame is a big-endian uint32 length followed by that many bytes.
+// Keys are sent as a sequence of frames, pairs as two frames each and
+// results as a big-endian uint16 status followed by a frame.
+
+func writeFrame(w io.Writer, data []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame returns io.EOF only if the body ended right before the frame
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	// Do not trust the declared length for allocation purposes
+	var buf bytes.Buffer
+	read, err := io.CopyN(&buf, r, n)
+	if read < n {
+		return nil, ErrTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func WriteKeys(w io.Writer, keys []string) error {
+	for _, key := range keys {
+		if err := writeFrame(w, []byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ReadKeys(r io.Reader) ([]string, error) {
+	var keys []string
+	for {
+		frame, err := readFrame(r)
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, string(frame))
+	}
+}
+
+func WritePairs(w io.Writer, pairs []Pair) error {
+	for _, pair := range pairs {
+		if err := writeFrame(w, []byte(pair.Key)); err != nil {
+			return err
+		}
+		if err := writeFrame(w, pair.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ReadPairs(r io.Reader) ([]Pair, error) {
+	var pairs []Pair
+	for {
+		key, err := readFrame(r)
+		if err == io.EOF {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := readFrame(r)
+		if err == io.EOF {
+			return nil, ErrTruncated
+		}
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, Pair{Key: string(key), Value: value})
+	}
+}
+
+func WriteResults(w io.Writer, results []Result) error {
+	for _, result := range results {
+		var status [2]byte
+		binary.BigEndian.PutUint16(status[:], uint16(result.Status))
+		if _, err := w.Write(status[:]); err != nil {
+			return err
+		}
+		if err := writeFrame(w, result.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ReadResults(r io.Reader) ([]Result, error) {
+	var results []Result
+	for {
+		var status [2]byte
+		if _, err := io.ReadFull(r, status[:]); err != nil {
+			if err == io.EOF {
+				return results, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return nil, ErrTruncated
+			}
+			return nil, err
+		}
+		value, err := readFrame(r)
+		if err == io.EOF {
+			return nil, ErrTruncated
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, Result{
+			Status: int(binary.BigEndian.Uint16(status[:])),
+			Value:  value,
+		})
+	}
+}
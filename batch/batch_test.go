@@ -0,0 +1,77 @@
+package batch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestKeys_RoundTrip(t *testing.T) {
+	keys := []string{"cpu", "", "mem/used"}
+	var buf bytes.Buffer
+	if err := WriteKeys(&buf, keys); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	have, err := ReadKeys(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	if !reflect.DeepEqual(keys, have) {
+		t.Errorf("unexpected keys. want %v, have %v", keys, have)
+	}
+}
+
+func TestPairs_RoundTrip(t *testing.T) {
+	pairs := []Pair{
+		{Key: "cpu", Value: []byte("98%")},
+		{Key: "mem", Value: []byte{}},
+	}
+	var buf bytes.Buffer
+	if err := WritePairs(&buf, pairs); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	have, err := ReadPairs(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	if !reflect.DeepEqual(pairs, have) {
+		t.Errorf("unexpected pairs. want %v, have %v", pairs, have)
+	}
+}
+
+func TestResults_RoundTrip(t *testing.T) {
+	results := []Result{
+		{Status: 200, Value: []byte("98%")},
+		{Status: 404, Value: []byte{}},
+	}
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, results); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	have, err := ReadResults(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	if !reflect.DeepEqual(results, have) {
+		t.Errorf("unexpected results. want %v, have %v", results, have)
+	}
+}
+
+func TestReadPairs_Truncated(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "partial header", body: []byte{0, 0}},
+		{name: "partial frame", body: []byte{0, 0, 0, 3, 'c', 'p'}},
+		{name: "missing value", body: []byte{0, 0, 0, 3, 'c', 'p', 'u'}},
+		{name: "oversized declared length", body: []byte{0xff, 0xff, 0xff, 0xff, 'c'}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadPairs(bytes.NewReader(test.body)); err != ErrTruncated {
+				t.Errorf("unexpected error. want ErrTruncated, have %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package mecachis
+
+import (
+	"sync/atomic"
+)
+
+// budget bounds the bytes the groups of a hub take altogether. Once it is
+// exceeded, entries are evicted from the group which is the most over its
+// share, shares being proportional to the weights of the groups. Groups
+// under their share are never evicted from, as the shares add up to the
+// budget
+type budget struct {
+	limit  uint64
+	groups func() []*group
+	// bytes the groups take as last measured plus those written since.
+	// Removals and evictions are not subtracted, hence it never falls
+	// behind, and enforcing only starts once it exceeds the limit
+	used int64
+	// set while evicting, as a single goroutine brings every group back
+	// within the budget
+	enforcing int32
+}
+
+func newBudget(limit uint64, groups func() []*group) *budget {
+	return &budget{limit: limit, groups: groups}
+}
+
+// grow accounts size bytes written, enforcing the budget if they may have
+// exceeded it
+func (b *budget) grow(size uint64) {
+	if b == nil || b.limit == 0 {
+		return
+	}
+	if atomic.AddInt64(&b.used, int64(size)) <= int64(b.limit) {
+		return
+	}
+	b.enforce()
+}
+
+// enforce evicts until the groups fit in the budget or only pinned entries
+// are left in those over their share. Callers racing with an ongoing
+// enforcement return right away
+func (b *budget) enforce() {
+	if !atomic.CompareAndSwapInt32(&b.enforcing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&b.enforcing, 0)
+	// Bytes written while measuring are kept in the estimate, even though
+	// the measure may have counted them already
+	seen := atomic.LoadInt64(&b.used)
+	var total uint64
+	defer func() {
+		atomic.AddInt64(&b.used, int64(total)-seen)
+	}()
+	groups := b.groups()
+	sizes := make([]uint64, len(groups))
+	exhausted := make([]bool, len(groups))
+	for {
+		var weights float64
+		total = 0
+		for i, g := range groups {
+			sizes[i] = g.size()
+			total += sizes[i]
+			weights += g.weight()
+		}
+		if total <= b.limit {
+			return
+		}
+		victim := -1
+		var most float64
+		for i, g := range groups {
+			over := float64(sizes[i]) - float64(b.limit)*g.weight()/weights
+			if over <= 0 || exhausted[i] {
+				continue
+			}
+			if victim < 0 || over > most {
+				victim, most = i, over
+			}
+		}
+		if victim < 0 {
+			return
+		}
+		// The victim is shrunk down to its share, unless less is needed
+		size := total - b.limit
+		if most >= 1 && uint64(most) < size {
+			size = uint64(most)
+		}
+		if groups[victim].shrink(size) == 0 {
+			exhausted[victim] = true
+		}
+	}
+}
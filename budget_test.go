@@ -0,0 +1,152 @@
+package mecachis
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHub_MemoryBudget(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()), WithMemoryBudget(64))
+	_ = hub.CreateGroup("small", GroupConfig{Shards: 1})
+	_ = hub.CreateGroup("large", GroupConfig{Shards: 2, Weight: 3})
+	small, _ := hub.group("small")
+	large, _ := hub.group("large")
+
+	// Keys of two bytes and values of six take 8 bytes each. The large group
+	// takes the whole budget while the small one is empty
+	for i := 0; i < 10; i++ {
+		_ = large.Add(fmt.Sprintf("l%d", i), MemoryView("value!"))
+	}
+	if have := large.size(); have != 64 {
+		t.Errorf("unexpected size of large. want 64, have %d", have)
+	}
+
+	// Then both are brought back to their shares, a quarter and three
+	// quarters of the budget
+	for i := 0; i < 10; i++ {
+		_ = small.Add(fmt.Sprintf("s%d", i), MemoryView("value!"))
+	}
+	if have := small.size(); have != 16 {
+		t.Errorf("unexpected size of small. want 16, have %d", have)
+	}
+	if have := large.size(); have != 48 {
+		t.Errorf("unexpected size of large. want 48, have %d", have)
+	}
+	if have := large.Stats().Evictions[EvictedBudget.String()]; have != 4 {
+		t.Errorf("unexpected budget evictions. want 4, have %d", have)
+	}
+	if _, ok := small.Get("s9"); !ok {
+		t.Errorf("unexpected cache result. expected latest key to be kept")
+	}
+}
+
+func TestHub_MemoryBudget_Pinned(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()), WithMemoryBudget(16))
+	_ = hub.CreateGroup("flags", GroupConfig{MaxPinned: 1})
+	_ = hub.CreateGroup("tmp", GroupConfig{})
+	flags, _ := hub.group("flags")
+	tmp, _ := hub.group("tmp")
+	for i := 0; i < 3; i++ {
+		_ = flags.AddItem(fmt.Sprintf("f%d", i), &Item{Data: MemoryView("value!"), Pinned: true})
+	}
+	// Pinned entries keep the budget exceeded, yet groups within their
+	// share are not evicted from to make up for it
+	_ = tmp.Add("t0", MemoryView("value!"))
+	if have := flags.size(); have != 24 {
+		t.Errorf("unexpected size of flags. want 24, have %d", have)
+	}
+	if have := tmp.size(); have != 8 {
+		t.Errorf("unexpected size of tmp. want 8, have %d", have)
+	}
+	// Beyond its share, tmp is evicted from until it is back within it
+	_ = tmp.Add("t1", MemoryView("value!"))
+	if have := tmp.size(); have != 8 {
+		t.Errorf("unexpected size of tmp. want 8, have %d", have)
+	}
+	if _, ok := tmp.Get("t1"); !ok {
+		t.Errorf("unexpected cache result. expected latest key to be kept")
+	}
+}
+
+func TestHub_ServeHTTP_Weight(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	recorder := conditionalRequest(hub, http.MethodPut, "/mecachis/sessions?cap=64&weight=2.5", "", nil)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code. want %d, have %d", http.StatusCreated, recorder.Code)
+	}
+	g, _ := hub.group("sessions")
+	if have := g.Info().Weight; have != 2.5 {
+		t.Errorf("unexpected weight. want 2.5, have %v", have)
+	}
+}
+
+func TestBudget_Grow(t *testing.T) {
+	var snapshots int
+	hub := NewHub(WithLogger(NopLogger()), WithMemoryBudget(64))
+	_ = hub.CreateGroup("sessions", GroupConfig{})
+	g, _ := hub.group("sessions")
+	snapshot := hub.budget.groups
+	hub.budget.groups = func() []*group {
+		snapshots++
+		return snapshot()
+	}
+
+	// Keys of two bytes and values of six take 8 bytes each
+	for i := 0; i < 8; i++ {
+		_ = g.Set("s0", MemoryView("value!"))
+	}
+	if snapshots != 0 {
+		t.Errorf("unexpected enforcements. want none within the budget, have %d", snapshots)
+	}
+	// Overwrites count as writes until the budget is enforced, which
+	// measures what the groups take
+	_ = g.Set("s0", MemoryView("value!"))
+	if snapshots != 1 {
+		t.Errorf("unexpected enforcements. want 1 once the budget may be exceeded, have %d", snapshots)
+	}
+	if have := g.size(); have != 8 {
+		t.Errorf("unexpected size. want 8, have %d", have)
+	}
+	_ = g.Set("s1", MemoryView("value!"))
+	if snapshots != 1 {
+		t.Errorf("unexpected enforcements. want 1 as measuring reset the estimate, have %d", snapshots)
+	}
+}
+
+func TestReadWeight(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want float64
+	}{
+		{raw: "2.5", want: 2.5},
+		{raw: "-1", want: 0},
+		{raw: "Inf", want: 0},
+		{raw: "NaN", want: 0},
+		{raw: "heavy", want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/mecachis/sessions?weight="+test.raw, nil)
+			if have := readWeight(r); have != test.want {
+				t.Errorf("unexpected weight. want %v, have %v", test.want, have)
+			}
+		})
+	}
+}
+
+func TestBudget_Grow_FailedWrites(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()), WithMemoryBudget(64))
+	_ = hub.CreateGroup("sessions", GroupConfig{Cap: 16})
+	g, _ := hub.group("sessions")
+
+	_ = g.Add("s0", MemoryView("value!"))
+	_ = g.Add("s0", MemoryView("value!"))
+	_ = g.Set("s1", MemoryView("far too large a value"))
+	_ = g.CompareAndSwap("s0", 0, MemoryView("value!"))
+	if have := atomic.LoadInt64(&hub.budget.used); have != 8 {
+		t.Errorf("unexpected budget estimate. want 8 as failed writes take no room, have %d", have)
+	}
+}
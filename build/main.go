@@ -4,16 +4,46 @@ import (
 	"flag"
 	"fmt"
 	"github.com/sonirico/mecachis"
+	"github.com/sonirico/mecachis/metrics"
 	"net/http"
+	"os"
 )
 
 func main() {
 	var port int
+	var accessLog, debug bool
+	var maxValueSize int64
+	var maxBatchLen int
+	var maxGroupCapacity, memoryBudget uint64
 	flag.IntVar(&port, "http", 8000, "http port")
+	flag.BoolVar(&accessLog, "access-log", false, "log every request served")
+	flag.BoolVar(&debug, "debug", false, "log debug records")
+	flag.Int64Var(&maxValueSize, "max-value-size", mecachis.DefaultMaxValueSize, "max value size in bytes, 0 for no limit")
+	flag.Uint64Var(&maxGroupCapacity, "max-group-cap", mecachis.DefaultMaxGroupCapacity, "max group capacity in bytes, 0 for no limit")
+	flag.IntVar(&maxBatchLen, "max-batch-len", mecachis.DefaultMaxBatchLen, "keys or pairs batch requests are sized for, 0 for no limit")
+	flag.Uint64Var(&memoryBudget, "memory-budget", 0, "bytes all groups may take altogether, 0 for no limit")
 	flag.Parse()
 
-	hub := mecachis.NewHub()
-	err := http.ListenAndServe(fmt.Sprintf(":%d", port), hub)
+	level := mecachis.LevelInfo
+	if debug {
+		level = mecachis.LevelDebug
+	}
+	opts := []mecachis.Option{
+		mecachis.WithLogger(mecachis.NewStdLogger(os.Stderr, level)),
+		mecachis.WithMaxValueSize(maxValueSize),
+		mecachis.WithMaxGroupCapacity(maxGroupCapacity),
+		mecachis.WithMaxBatchLen(maxBatchLen),
+		mecachis.WithMemoryBudget(memoryBudget),
+	}
+	if accessLog {
+		opts = append(opts, mecachis.WithAccessLog())
+	}
+	hub := mecachis.NewHub(opts...)
+	exporter := metrics.NewExporter(hub)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	mux.Handle("/", exporter.Instrument(hub))
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
 	if err != nil {
 		panic(err)
 	}
@@ -1,57 +1,544 @@
 package mecachis
 
 import (
+	"github.com/sonirico/mecachis/codec"
 	e "github.com/sonirico/mecachis/engines"
+	blru "github.com/sonirico/mecachis/engines/blru"
+	gdsf "github.com/sonirico/mecachis/engines/gdsf"
+	lfru "github.com/sonirico/mecachis/engines/lfru"
+	lfu "github.com/sonirico/mecachis/engines/lfu"
 	lru "github.com/sonirico/mecachis/engines/lru"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
-	basePath = "/mecachis/"
+	basePath      = "/mecachis/"
+	mgetKey       = "_mget"
+	msetKey       = "_mset"
+	invalidateKey = "_invalidate"
+	statsPath     = "_stats"
 )
 
+// DefaultMaxPinned is the fraction of the capacity of a cache pinned keys
+// may take unless told otherwise
+const DefaultMaxPinned = 0.5
+
 type Cache interface {
 	Add(k string, v MemoryView) error
+	AddItem(k string, it *Item) error
+	AddMany(kvs []KeyValue) []error
+	Set(k string, v MemoryView) error
+	SetIf(k string, v MemoryView, cond Condition) error
+	SetItem(k string, it *Item, cond Condition) (*Item, error)
+	CompareAndSwap(k string, version uint64, v MemoryView) error
 	Get(k string) (MemoryView, bool)
+	GetMany(ks []string) map[string]MemoryView
+	Lookup(k string) (*Item, bool)
+	Peek(k string) (*Item, bool)
+	Inspect(k string) (KeyInfo, bool)
+	Remove(k string) error
+	RemoveIf(k string, cond Condition) error
+	InvalidateTag(tag string) int
+	InvalidatePrefix(prefix string) int
+	Pin(k string) error
+	Unpin(k string) error
+	Scan(cursor string, count int, pattern string) (ScanResult, error)
+	Shrink(size uint64) uint64
+	Size() uint64
+	Stats() Stats
+}
+
+type KeyValue struct {
+	Key   string
+	Value MemoryView
 }
 
+// cache guards a single engine. Engines mutate their policy state on
+// every access, hence reads take the write lock as well unless the engine
+// is safe for concurrent use
 type cache struct {
 	sync.RWMutex
 
-	engine e.Engine
+	engine     e.Engine
+	concurrent bool
+	capacity   uint64
+	maxEntries uint64
+	maxPinned  float64
+	codec      codec.Codec
+	admission  []Admission
+	tags       tagIndex
+	counters   counters
+	// why the engine is evicting, capacity unless told otherwise
+	reason EvictionReason
+}
+
+type CacheOption func(*cache)
+
+// WithCodec compresses values on insert. Capacity is accounted on the
+// compressed size
+func WithCodec(c codec.Codec) CacheOption {
+	return func(cache *cache) {
+		cache.codec = c
+	}
+}
+
+// WithMaxPinned sets the fraction of the capacity pinned keys may take,
+// DefaultMaxPinned if not positive. Unbounded caches pin without limit
+func WithMaxPinned(fraction float64) CacheOption {
+	return func(cache *cache) {
+		if fraction > 1 {
+			fraction = 1
+		}
+		if fraction > 0 {
+			cache.maxPinned = fraction
+		}
+	}
+}
+
+// WithMaxEntries bounds the cache by how many keys it holds besides its
+// capacity in bytes. Zero means no bound
+func WithMaxEntries(n uint64) CacheOption {
+	return func(cache *cache) {
+		cache.maxEntries = n
+	}
+}
+
+// WithAdmission makes new keys go through every policy before getting into
+// the cache. Keys larger than the capacity are rejected regardless
+func WithAdmission(policies ...Admission) CacheOption {
+	return func(cache *cache) {
+		cache.admission = append(cache.admission, policies...)
+	}
+}
+
+func NewCache(cap uint64, cType e.CacheType, opts ...CacheOption) *cache {
+	c := &cache{
+		capacity:  cap,
+		maxPinned: DefaultMaxPinned,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.engine = NewBoundedEngine(cType, e.Capacity{Bytes: cap, Entries: c.maxEntries})
+	_, c.concurrent = c.engine.(e.Concurrent)
+	c.engine.OnEvict(c.onEvict)
+	return c
+}
+
+func (c *cache) onEvict(entry e.Entry) {
+	c.tags.set(entry.Key(), nil)
+	c.counters.evict(c.reason)
+}
+
+func (c *cache) lockRead() {
+	if !c.concurrent {
+		c.Lock()
+	}
 }
 
-func NewCache(cap uint64, cType e.CacheType) *cache {
-	return &cache{
-		engine: newEngine(cType, cap),
+func (c *cache) unlockRead() {
+	if !c.concurrent {
+		c.Unlock()
 	}
 }
 
 func (c *cache) Add(key string, value MemoryView) error {
+	return c.AddItem(key, newItem(value))
+}
+
+// AddItem adds the value of the item along with its metadata. Validators
+// and version are computed by the cache, whatever the item holds
+func (c *cache) AddItem(key string, item *Item) error {
+	encoded := item.encode(c.codec)
 	c.Lock()
 	defer c.Unlock()
-	res := c.engine.Insert(key, value)
+	c.current(key)
+	return c.insert(key, encoded.stamp(nil))
+}
+
+// AddMany adds every pair taking the lock only once. The returned slice
+// holds the outcome of each insertion, in the same order as kvs
+func (c *cache) AddMany(kvs []KeyValue) []error {
+	encoded := make([]*Item, len(kvs))
+	for i, kv := range kvs {
+		encoded[i] = newItem(kv.Value).encode(c.codec)
+	}
+	c.Lock()
+	defer c.Unlock()
+	errs := make([]error, len(kvs))
+	for i, kv := range kvs {
+		c.current(kv.Key)
+		errs[i] = c.insert(kv.Key, encoded[i].stamp(nil))
+	}
+	return errs
+}
+
+// admit tells whether the item may be written under key. Items larger
+// than the capacity never are, as the engine would evict every other key
+// before evicting them as well, and pinned ones must fit in the room left
+// for pins. Admission policies only apply to keys not cached yet. Runs
+// before anything changes, so that rejected writes leave the cache as it
+// was. Must be called with the lock held
+func (c *cache) admit(key string, item *Item) error {
+	size := uint64(len(key)) + item.Len()
+	if c.capacity > 0 && size > c.capacity {
+		return NewTooLargeError("'"+key+"'", c.capacity)
+	}
+	if item.Pinned {
+		if err := c.checkPin(key, size); err != nil {
+			return err
+		}
+	}
+	if _, cached := c.engine.Peek(key); cached {
+		return nil
+	}
+	for _, policy := range c.admission {
+		if err := policy.Admit(key, size, c.capacity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert must be called with the lock held
+func (c *cache) insert(key string, item *Item) error {
+	if err := c.admit(key, item); err != nil {
+		return err
+	}
+	return c.place(key, item)
+}
+
+// place puts the item into the engine once admitted. Must be called with
+// the lock held
+func (c *cache) place(key string, item *Item) error {
+	// Tags are indexed beforehand, as the engine may evict the item right
+	// away if it does not fit
+	previous := c.tags.set(key, item.Tags)
+	res := c.engine.Insert(key, item)
+	c.counters.insert(res)
 	if !res {
+		c.tags.set(key, previous)
 		return NewDuplicatedKeyError(key)
 	}
 	return nil
 }
 
-func (c *cache) Get(key string) (MemoryView, bool) {
+// checkPin tells whether pinning size bytes under key would exceed the
+// fraction of the capacity pinned keys may take. The bytes the key pins
+// already do not count, as they are to be replaced. Must be called with
+// the lock held
+func (c *cache) checkPin(key string, size uint64) error {
+	if c.capacity == 0 {
+		return nil
+	}
+	limit := uint64(float64(c.capacity) * c.maxPinned)
+	pinned := c.engine.Pinned()
+	if info, ok := c.engine.Inspect(key); ok && info.Pinned {
+		pinned -= info.Size
+	}
+	if pinned+size > limit {
+		return NewPinLimitError(key, limit)
+	}
+	return nil
+}
+
+// current returns the item cached under key, to be checked against write
+// conditions. The key is peeked, as writes are no accesses. Expired items
+// are dropped, hence never returned. Must be called with the lock held
+func (c *cache) current(key string) *Item {
+	res, ok := c.engine.Peek(key)
+	if !ok {
+		return nil
+	}
+	item := res.(*Item)
+	if item.expired(time.Now()) {
+		c.engine.Remove(key)
+		c.tags.set(key, nil)
+		c.counters.evict(EvictedExpired)
+		return nil
+	}
+	return item
+}
+
+// Set puts a key-value pair into the cache, replacing the previous value
+// if the key was cached already
+func (c *cache) Set(key string, value MemoryView) error {
+	_, err := c.SetItem(key, newItem(value), nil)
+	return err
+}
+
+// SetIf behaves like Set as long as cond holds for the item currently
+// cached under the key. Otherwise, *ErrPreconditionFailed is returned
+func (c *cache) SetIf(key string, value MemoryView, cond Condition) error {
+	_, err := c.SetItem(key, newItem(value), cond)
+	return err
+}
+
+// SetItem sets the value of the item along with its metadata. A nil cond
+// makes the write unconditional. Returns the item as stored
+func (c *cache) SetItem(key string, item *Item, cond Condition) (*Item, error) {
+	encoded := item.encode(c.codec)
+	c.Lock()
+	defer c.Unlock()
+	current := c.current(key)
+	if cond != nil && !cond(current) {
+		return nil, NewPreconditionFailedError(key)
+	}
+	stamped := encoded.stamp(current)
+	if err := c.set(key, stamped); err != nil {
+		return nil, err
+	}
+	return stamped, nil
+}
+
+// CompareAndSwap sets the value only if the key is still at the given
+// version, as returned by Lookup. Version zero means the key must not be
+// cached. Otherwise, *ErrPreconditionFailed is returned
+func (c *cache) CompareAndSwap(key string, version uint64, value MemoryView) error {
+	return c.SetIf(key, value, versionIs(version))
+}
+
+// set must be called with the lock held. The item is admitted before the
+// previous one goes away, which is kept if it is not
+func (c *cache) set(key string, item *Item) error {
+	if err := c.admit(key, item); err != nil {
+		return err
+	}
+	if c.engine.Remove(key) {
+		c.counters.evict(EvictedReplaced)
+	}
+	return c.place(key, item)
+}
+
+func (c *cache) Remove(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.remove(key)
+}
+
+// RemoveIf behaves like Remove as long as cond holds for the item currently
+// cached under the key. Otherwise, *ErrPreconditionFailed is returned
+func (c *cache) RemoveIf(key string, cond Condition) error {
+	c.Lock()
+	defer c.Unlock()
+	if !cond(c.current(key)) {
+		return NewPreconditionFailedError(key)
+	}
+	return c.remove(key)
+}
+
+// remove must be called with the lock held
+func (c *cache) remove(key string) error {
+	if !c.engine.Remove(key) {
+		return NewKeyNotFoundError(key)
+	}
+	c.tags.set(key, nil)
+	c.counters.evict(EvictedRemoved)
+	return nil
+}
+
+// Pin exempts the key from eviction until it is unpinned or removed. Its
+// size still counts toward the capacity. Replacing the key keeps it pinned
+// only if the new item is. Returns *ErrPinLimit if pinned keys would take
+// more than the fraction of the capacity allowed, see WithMaxPinned
+func (c *cache) Pin(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	item := c.current(key)
+	if item == nil {
+		return NewKeyNotFoundError(key)
+	}
+	if info, _ := c.engine.Inspect(key); info.Pinned {
+		return nil
+	}
+	if err := c.checkPin(key, uint64(len(key))+item.Len()); err != nil {
+		return err
+	}
+	c.engine.Pin(key)
+	return nil
+}
+
+// Unpin makes the key evictable again
+func (c *cache) Unpin(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.current(key) == nil {
+		return NewKeyNotFoundError(key)
+	}
+	c.engine.Unpin(key)
+	return nil
+}
+
+// InvalidateTag removes every key cached with the tag, returning how many
+func (c *cache) InvalidateTag(tag string) int {
+	c.Lock()
+	defer c.Unlock()
+	removed := 0
+	for _, key := range c.tags.keys(tag) {
+		if c.remove(key) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// InvalidatePrefix removes every key starting with prefix, returning how
+// many. It goes through every key cached
+func (c *cache) InvalidatePrefix(prefix string) int {
+	c.Lock()
+	defer c.Unlock()
+	removed := 0
+	for _, entry := range c.engine.Dump() {
+		if strings.HasPrefix(entry.Key(), prefix) && c.remove(entry.Key()) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Scan lists up to count keys matching the glob pattern, resuming from
+// cursor. Expired keys are left out, hence pages may fall short of count
+// before the scan is over
+func (c *cache) Scan(cursor string, count int, pattern string) (ScanResult, error) {
+	if !e.ValidPattern(pattern) {
+		return ScanResult{}, NewInvalidPatternError(pattern)
+	}
 	c.RLock()
 	defer c.RUnlock()
-	res, ok := c.engine.Access(key)
+	entries, next := c.engine.Scan(cursor, count, pattern)
+	result := ScanResult{Keys: make([]ScannedKey, 0, len(entries)), Cursor: next}
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.Value().(*Item).expired(now) {
+			continue
+		}
+		result.Keys = append(result.Keys, ScannedKey{Key: entry.Key(), Size: entry.Len()})
+	}
+	return result, nil
+}
+
+// Shrink evicts entries the way the engine would to make room, until size
+// bytes are freed or only pinned ones are left. Returns how many bytes were
+// freed
+func (c *cache) Shrink(size uint64) uint64 {
+	c.Lock()
+	defer c.Unlock()
+	c.reason = EvictedBudget
+	defer func() { c.reason = EvictedCapacity }()
+	before := c.engine.Size()
+	for before-c.engine.Size() < size && c.engine.Evict() {
+	}
+	return before - c.engine.Size()
+}
+
+func (c *cache) Size() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.engine.Size()
+}
+
+func (c *cache) Stats() Stats {
+	stats := c.counters.snapshot()
+	stats.Bytes = c.Size()
+	return stats
+}
+
+func (c *cache) Get(key string) (MemoryView, bool) {
+	item, ok := c.Lookup(key)
 	if !ok {
 		return nil, false
 	}
-	data := res.(MemoryView)
-	return data, ok
+	value, err := item.Decode()
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Lookup returns the item cached under key, along with its attributes. Its
+// Data stays compressed, see Item.Decode. Expired items are missed, and
+// left for writes or the engine to drop
+func (c *cache) Lookup(key string) (*Item, bool) {
+	c.lockRead()
+	defer c.unlockRead()
+	res, ok := c.engine.Access(key)
+	if !ok || res.(*Item).expired(time.Now()) {
+		c.counters.miss()
+		return nil, false
+	}
+	c.counters.hit()
+	return res.(*Item), true
+}
+
+// Peek returns the item cached under key like Lookup does, but neither
+// promotes the key nor counts as a hit or a miss
+func (c *cache) Peek(key string) (*Item, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	res, ok := c.engine.Peek(key)
+	if !ok || res.(*Item).expired(time.Now()) {
+		return nil, false
+	}
+	return res.(*Item), true
+}
+
+// Inspect describes the key cached, without touching it
+func (c *cache) Inspect(key string) (KeyInfo, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	res, ok := c.engine.Peek(key)
+	if !ok || res.(*Item).expired(time.Now()) {
+		return KeyInfo{}, false
+	}
+	usage, _ := c.engine.Inspect(key)
+	return newKeyInfo(key, res.(*Item), usage), true
+}
+
+// GetMany looks up every key taking the lock only once. Keys which are not
+// cached are absent from the result
+func (c *cache) GetMany(keys []string) map[string]MemoryView {
+	c.lockRead()
+	defer c.unlockRead()
+	result := make(map[string]MemoryView, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		res, ok := c.engine.Access(key)
+		if !ok || res.(*Item).expired(now) {
+			c.counters.miss()
+			continue
+		}
+		c.counters.hit()
+		value, err := res.(*Item).Decode()
+		if err != nil {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// NewEngine returns an engine of the given type holding up to capacity
+// bytes, or nil if the type is not supported
+func NewEngine(cType e.CacheType, capacity uint64) e.Engine {
+	return NewBoundedEngine(cType, e.Capacity{Bytes: capacity})
 }
 
-func newEngine(cType e.CacheType, capacity uint64) e.Engine {
+// NewBoundedEngine returns an engine of the given type bounded by bytes,
+// entries or both, or nil if the type is not supported
+func NewBoundedEngine(cType e.CacheType, capacity e.Capacity) e.Engine {
 	switch cType {
 	case e.LRU:
-		return lru.New(capacity)
+		return lru.NewBounded(capacity)
+	case e.LFU:
+		return lfu.NewBounded(capacity)
+	case e.LFRU:
+		return lfru.NewBounded(capacity)
+	case e.BLRU:
+		return blru.NewBounded(capacity)
+	case e.GDSF:
+		return gdsf.NewBounded(capacity)
 	}
 	return nil
 }
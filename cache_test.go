@@ -0,0 +1,288 @@
+package mecachis
+
+import (
+	"fmt"
+	"github.com/sonirico/mecachis/codec"
+	"github.com/sonirico/mecachis/engines"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func hammer(t *testing.T, c Cache) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	workers := 8
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key-%d", i%64)
+				switch i % 4 {
+				case 0:
+					_ = c.Add(key, MemoryView("value"))
+				case 1:
+					_ = c.Set(key, MemoryView(fmt.Sprintf("value-%d", w)))
+				case 2:
+					_ = c.GetMany([]string{key, "key-0", "key-1"})
+				default:
+					c.Get(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// Run with -race to make sure concurrent reads do not race on the policy
+// state the engines mutate on every access
+func TestCache_Concurrent(t *testing.T) {
+	hammer(t, NewCache(512, engines.LRU))
+}
+
+func TestCache_Concurrent_BLRU(t *testing.T) {
+	hammer(t, NewCache(512, engines.BLRU))
+}
+
+func TestShardedCache_Concurrent(t *testing.T) {
+	hammer(t, NewShardedCache(512, engines.LRU, 8))
+}
+
+func TestShardedCache_SplitsCapacity(t *testing.T) {
+	c := NewShardedCache(10, engines.LRU, 4)
+	for i := 0; i < 100; i++ {
+		_ = c.Add(fmt.Sprintf("%d", i), MemoryView("v"))
+	}
+	// Every shard holds at most ceil(10/4) = 3 bytes
+	if c.Size() > 12 {
+		t.Errorf("unexpected cache size. want at most 12, have %d", c.Size())
+	}
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	for _, ct := range []engines.CacheType{engines.LRU, engines.LFU, engines.LFRU, engines.BLRU, engines.GDSF} {
+		c := NewCache(1024, ct, WithMaxEntries(3))
+		for i := 0; i < 10; i++ {
+			_ = c.Add(fmt.Sprintf("%d", i), MemoryView("v"))
+		}
+		if have := c.Stats().Entries; have != 3 {
+			t.Errorf("unexpected %s entries. want 3, have %d", ct, have)
+		}
+	}
+}
+
+func TestShardedCache_SplitsMaxEntries(t *testing.T) {
+	c := NewShardedCache(0, engines.LRU, 4, WithMaxEntries(10))
+	for i := 0; i < 100; i++ {
+		_ = c.Add(fmt.Sprintf("%d", i), MemoryView("v"))
+	}
+	// Every shard holds at most ceil(10/4) = 3 entries
+	if have := c.Stats().Entries; have > 12 {
+		t.Errorf("unexpected entries. want at most 12, have %d", have)
+	}
+}
+
+func TestShardedCache_ManyKeepOrder(t *testing.T) {
+	c := NewShardedCache(0, engines.LRU, 4)
+	_ = c.Add("b", MemoryView("2"))
+	errs := c.AddMany([]KeyValue{
+		{Key: "a", Value: MemoryView("1")},
+		{Key: "b", Value: MemoryView("2")},
+		{Key: "c", Value: MemoryView("3")},
+	})
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Errorf("unexpected per-key errors. want [nil ErrDuplicatedKey nil], have %v", errs)
+	}
+	values := c.GetMany([]string{"a", "b", "c", "d"})
+	if len(values) != 3 || values["c"].String() != "3" {
+		t.Errorf("unexpected values. want a, b and c, have %v", values)
+	}
+}
+
+func TestCache_Stats(t *testing.T) {
+	c := NewCache(6, engines.LRU)
+	_ = c.Add("a", MemoryView("1")) // +2
+	_ = c.Add("a", MemoryView("1")) // duplicate
+	_ = c.Add("b", MemoryView("2")) // +2
+	_ = c.Set("b", MemoryView("3")) // replaces "b"
+	_ = c.Add("c", MemoryView("4")) // +2
+	_ = c.Add("d", MemoryView("5")) // evicts "a"
+	_ = c.Remove("c")               // -2
+	c.Get("b")
+	c.Get("a")
+	c.GetMany([]string{"b", "c", "d"})
+
+	want := Stats{
+		Hits:             3,
+		Misses:           2,
+		Inserts:          5,
+		DuplicateInserts: 1,
+		Evictions: map[string]uint64{
+			"budget":   0,
+			"capacity": 1,
+			"expired":  0,
+			"removed":  1,
+			"replaced": 1,
+		},
+		Bytes:   4,
+		Entries: 2,
+	}
+	if have := c.Stats(); !reflect.DeepEqual(want, have) {
+		t.Errorf("unexpected stats. want %+v, have %+v", want, have)
+	}
+}
+
+func TestShardedCache_Stats(t *testing.T) {
+	c := NewShardedCache(0, engines.LRU, 4)
+	for i := 0; i < 10; i++ {
+		_ = c.Add(fmt.Sprintf("%d", i), MemoryView("v"))
+	}
+	for i := 0; i < 10; i++ {
+		c.Get(fmt.Sprintf("%d", i*2))
+	}
+	stats := c.Stats()
+	if stats.Entries != 10 || stats.Inserts != 10 || stats.Bytes != 20 {
+		t.Errorf("unexpected stats. want 10 entries of 2 bytes, have %+v", stats)
+	}
+	if stats.Hits+stats.Misses != 10 || stats.Hits != 5 {
+		t.Errorf("unexpected lookups. want 5 hits out of 10, have %+v", stats)
+	}
+}
+
+func benchmarkGetParallel(b *testing.B, c Cache) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		_ = c.Add(keys[i], MemoryView("value"))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func BenchmarkCache_Get_Parallel(b *testing.B) {
+	benchmarkGetParallel(b, NewCache(0, engines.LRU))
+}
+
+func BenchmarkShardedCache_Get_Parallel(b *testing.B) {
+	benchmarkGetParallel(b, NewShardedCache(0, engines.LRU, 32))
+}
+
+func BenchmarkCache_Get_Parallel_BLRU(b *testing.B) {
+	benchmarkGetParallel(b, NewCache(0, engines.BLRU))
+}
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	c := NewCache(0, engines.LRU)
+	if err := c.CompareAndSwap("a", 0, MemoryView("1")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	first, _ := c.Lookup("a")
+	if err := c.CompareAndSwap("a", 0, MemoryView("2")); err == nil {
+		t.Errorf("expected version zero to fail on cached key")
+	}
+	if err := c.CompareAndSwap("a", first.Version(), MemoryView("2")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	second, _ := c.Lookup("a")
+	if second.Version() <= first.Version() {
+		t.Errorf("expected version to increase. have %d after %d", second.Version(), first.Version())
+	}
+	err := c.CompareAndSwap("a", first.Version(), MemoryView("3"))
+	if _, ok := err.(*ErrPreconditionFailed); !ok {
+		t.Errorf("unexpected error. want ErrPreconditionFailed, have %v", err)
+	}
+	if value, _ := c.Get("a"); value.String() != "2" {
+		t.Errorf("unexpected value. want '2', have '%s'", value.String())
+	}
+}
+
+func TestCache_Codec(t *testing.T) {
+	gzip, _ := codec.Lookup("gzip")
+	value := MemoryView(strings.Repeat(`{"cpu":98,"mem":"13gb"},`, 32))
+	c := NewCache(0, engines.LRU, WithCodec(gzip))
+	_ = c.Add("metrics", value)
+	_ = c.Add("mem", MemoryView("13gb"))
+
+	if c.Size() >= uint64(len("metrics")+len(value)) {
+		t.Errorf("expected capacity to be accounted on compressed size. have %d", c.Size())
+	}
+	if have, _ := c.Get("metrics"); have.String() != value.String() {
+		t.Errorf("unexpected value. want '%s', have '%s'", value.String(), have.String())
+	}
+	item, _ := c.Lookup("metrics")
+	if item.Encoding() != "gzip" || item.ETag != etag(value) {
+		t.Errorf("unexpected item. want gzip encoded and tagged after the value, have '%s' and %s", item.Encoding(), item.ETag)
+	}
+	// Compressing tiny values does not pay off
+	if item, _ := c.Lookup("mem"); item.Encoding() != "" {
+		t.Errorf("unexpected encoding. want none, have '%s'", item.Encoding())
+	}
+}
+
+// blockingCodec holds encodings until released
+type blockingCodec struct {
+	encoding chan struct{}
+	release  chan struct{}
+}
+
+func (b blockingCodec) Name() string { return "blocking" }
+
+func (b blockingCodec) Encode(src []byte) ([]byte, error) {
+	b.encoding <- struct{}{}
+	<-b.release
+	return src, nil
+}
+
+func (b blockingCodec) Decode(src []byte) ([]byte, error) { return src, nil }
+
+func TestCache_Codec_Unlocked(t *testing.T) {
+	blocking := blockingCodec{encoding: make(chan struct{}), release: make(chan struct{})}
+	c := NewCache(0, engines.LRU, WithCodec(blocking))
+	_ = c.AddItem("mem", &Item{Data: MemoryView("13gb"), Meta: Meta{ContentEncoding: "identity"}})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Add("metrics", MemoryView("cpu=98"))
+	}()
+	<-blocking.encoding
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		c.Get("mem")
+	}()
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Errorf("unexpected lock. want reads served while encoding")
+	}
+	close(blocking.release)
+	<-done
+}
+
+func TestCache_Expires(t *testing.T) {
+	c := NewCache(0, engines.LRU)
+	_ = c.AddItem("mem", &Item{Data: MemoryView("13gb"), Expires: time.Now().Add(-time.Second)})
+	if _, ok := c.Get("mem"); ok {
+		t.Errorf("unexpected cache result. expected expired item to be missed")
+	}
+	if err := c.Add("mem", MemoryView("12gb")); err != nil {
+		t.Fatalf("unexpected error. want nil as the item expired, have %v", err)
+	}
+	if value, _ := c.Get("mem"); value.String() != "12gb" {
+		t.Errorf("unexpected value. want '12gb', have '%s'", value.String())
+	}
+	if stats := c.Stats(); stats.Evictions["expired"] != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected stats. want 1 expired eviction and 1 entry, have %+v", stats)
+	}
+}
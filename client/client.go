@@ -0,0 +1,523 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sonirico/mecachis"
+	"github.com/sonirico/mecachis/batch"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	basePath = "/mecachis/"
+	mgetKey  = "_mget"
+	msetKey  = "_mset"
+
+	defaultTimeout      = 5 * time.Second
+	defaultMaxIdleConns = 64
+	defaultRetries      = 2
+	defaultBackoff      = 50 * time.Millisecond
+)
+
+// StatusError is returned whenever the server replies with an unexpected
+// status code which cannot be mapped to any of the typed errors
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.Code, e.Body)
+}
+
+// GroupConfig holds the parameters a group is created with
+type GroupConfig struct {
+	Capacity uint64
+	Engine   string
+	Shards   int
+	// Codec compresses values on the server, one of gzip, zstd or snappy
+	Codec string
+	// MaxPinned is the fraction of the capacity pinned keys may take
+	MaxPinned float64
+	// MaxEntries bounds how many keys the group holds besides Capacity
+	MaxEntries uint64
+	// Weight is the share of the memory budget of the server the group is
+	// entitled to, relative to other groups
+	Weight float64
+	// MaxSize rejects keys larger than this fraction of the capacity
+	MaxSize float64
+	// Doorkeeper only admits keys the second time they are written, and is
+	// sized for this many distinct keys
+	Doorkeeper uint64
+	// AdmitProbability admits new keys with this probability
+	AdmitProbability float64
+}
+
+// GroupInfo describes a group as reported by the server
+type GroupInfo struct {
+	Ns         string  `json:"ns"`
+	Cap        uint64  `json:"cap"`
+	MaxEntries uint64  `json:"max_entries"`
+	Weight     float64 `json:"weight"`
+	Engine     string  `json:"engine"`
+	Shards     int     `json:"shards"`
+	Codec      string  `json:"codec"`
+	Size       uint64  `json:"size"`
+}
+
+// Client talks to a mecachis Hub over HTTP
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	// timeout bounds every attempt, whichever the http client
+	timeout time.Duration
+	// maxIdleConns sizes the pool of the default transport
+	maxIdleConns int
+	retries      int
+	backoff      time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the underlying http client, which is used as it
+// is: pooling options are ignored, as they apply to the default transport
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTimeout sets the maximum amount of time a single attempt may take.
+// Zero lifts the limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithMaxIdleConns sets how many keep-alive connections are pooled
+func WithMaxIdleConns(n int) Option {
+	return func(c *Client) {
+		c.maxIdleConns = n
+	}
+}
+
+// WithRetries sets how many times an idempotent, unconditional request is
+// retried after a server error, waiting an exponentially increasing time
+// starting at backoff
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// New returns a client for the hub listening at endpoint, such as
+// "http://localhost:8000"
+func New(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		endpoint:     strings.TrimRight(endpoint, "/"),
+		timeout:      defaultTimeout,
+		maxIdleConns: defaultMaxIdleConns,
+		retries:      defaultRetries,
+		backoff:      defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Transport: newTransport(c.maxIdleConns)}
+	}
+	return c
+}
+
+func newTransport(maxIdleConns int) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// Get returns the value cached under key in the group ns
+func (c *Client) Get(ctx context.Context, ns, key string) ([]byte, error) {
+	res, err := c.do(ctx, http.MethodGet, keyPath(ns, key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch res.code {
+	case http.StatusOK:
+		return res.body, nil
+	case http.StatusNotFound:
+		return nil, mecachis.NewKeyNotFoundError(key)
+	}
+	return nil, res.statusError()
+}
+
+// GetVersion returns the value cached under key along with its version, to
+// be passed to CompareAndSwap
+func (c *Client) GetVersion(ctx context.Context, ns, key string) ([]byte, uint64, error) {
+	res, err := c.do(ctx, http.MethodGet, keyPath(ns, key), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch res.code {
+	case http.StatusOK:
+		version, err := strconv.ParseUint(res.header.Get(mecachis.VersionHeader), 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+		return res.body, version, nil
+	case http.StatusNotFound:
+		return nil, 0, mecachis.NewKeyNotFoundError(key)
+	}
+	return nil, 0, res.statusError()
+}
+
+// CompareAndSwap sets value only if the key is still at the given version.
+// Version zero means the key must not be cached. Returns
+// *mecachis.ErrPreconditionFailed if somebody else wrote the key meanwhile
+func (c *Client) CompareAndSwap(ctx context.Context, ns, key string, version uint64, value []byte) error {
+	header := http.Header{mecachis.IfVersionHeader: {strconv.FormatUint(version, 10)}}
+	res, err := c.doWith(ctx, http.MethodPut, keyPath(ns, key), nil, header, value)
+	if err != nil {
+		return err
+	}
+	switch res.code {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed:
+		return mecachis.NewPreconditionFailedError(key)
+	}
+	return res.writeError(key)
+}
+
+// Add caches value under key unless the key is cached already, in which case
+// *mecachis.ErrDuplicatedKey is returned. The group is created on demand
+// with default settings
+func (c *Client) Add(ctx context.Context, ns, key string, value []byte) error {
+	res, err := c.do(ctx, http.MethodPost, keyPath(ns, key), nil, value)
+	if err != nil {
+		return err
+	}
+	switch res.code {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return mecachis.NewDuplicatedKeyError(key)
+	}
+	return res.writeError(key)
+}
+
+// GetMany fetches several keys from the group ns in a single round trip.
+// Keys which are not cached are absent from the result
+func (c *Client) GetMany(ctx context.Context, ns string, keys []string) (map[string][]byte, error) {
+	var payload bytes.Buffer
+	if err := batch.WriteKeys(&payload, keys); err != nil {
+		return nil, err
+	}
+	res, err := c.doWith(ctx, http.MethodPost, keyPath(ns, mgetKey), nil, batchHeader(), payload.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if res.code != http.StatusOK {
+		return nil, res.statusError()
+	}
+	results, err := batch.ReadResults(bytes.NewReader(res.body))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(keys) {
+		return nil, batch.ErrTruncated
+	}
+	values := make(map[string][]byte, len(keys))
+	for i, result := range results {
+		if result.Status == http.StatusOK {
+			values[keys[i]] = result.Value
+		}
+	}
+	return values, nil
+}
+
+// AddMany caches several pairs in a single round trip. The returned slice
+// holds the outcome of each insertion, in the same order as pairs
+func (c *Client) AddMany(ctx context.Context, ns string, pairs []batch.Pair) ([]error, error) {
+	var payload bytes.Buffer
+	if err := batch.WritePairs(&payload, pairs); err != nil {
+		return nil, err
+	}
+	res, err := c.doWith(ctx, http.MethodPost, keyPath(ns, msetKey), nil, batchHeader(), payload.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if res.code != http.StatusOK {
+		return nil, res.statusError()
+	}
+	results, err := batch.ReadResults(bytes.NewReader(res.body))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(pairs) {
+		return nil, batch.ErrTruncated
+	}
+	errs := make([]error, len(pairs))
+	for i, result := range results {
+		switch result.Status {
+		case http.StatusCreated:
+		case http.StatusConflict:
+			errs[i] = mecachis.NewDuplicatedKeyError(pairs[i].Key)
+		default:
+			errs[i] = (&response{code: result.Status}).writeError(pairs[i].Key)
+		}
+	}
+	return errs, nil
+}
+
+// Set caches value under key, replacing any previous value
+func (c *Client) Set(ctx context.Context, ns, key string, value []byte) error {
+	res, err := c.do(ctx, http.MethodPut, keyPath(ns, key), nil, value)
+	if err != nil {
+		return err
+	}
+	if res.code == http.StatusNoContent {
+		return nil
+	}
+	return res.writeError(key)
+}
+
+// Delete removes key from the group ns
+func (c *Client) Delete(ctx context.Context, ns, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, keyPath(ns, key), nil, nil)
+	if err != nil {
+		return err
+	}
+	switch res.code {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return mecachis.NewKeyNotFoundError(key)
+	}
+	return res.statusError()
+}
+
+// CreateGroup creates the group ns with the given configuration. Returns
+// *mecachis.ErrDuplicatedGroup if it exists already
+func (c *Client) CreateGroup(ctx context.Context, ns string, cfg GroupConfig) error {
+	query := url.Values{}
+	if cfg.Capacity > 0 {
+		query.Set("cap", strconv.FormatUint(cfg.Capacity, 10))
+	}
+	if cfg.Engine != "" {
+		query.Set("engi", cfg.Engine)
+	}
+	if cfg.Shards > 0 {
+		query.Set("shards", strconv.Itoa(cfg.Shards))
+	}
+	if cfg.Codec != "" {
+		query.Set("codec", cfg.Codec)
+	}
+	if cfg.MaxPinned > 0 {
+		query.Set("maxpinned", strconv.FormatFloat(cfg.MaxPinned, 'f', -1, 64))
+	}
+	if cfg.MaxEntries > 0 {
+		query.Set("maxentries", strconv.FormatUint(cfg.MaxEntries, 10))
+	}
+	if cfg.Weight > 0 {
+		query.Set("weight", strconv.FormatFloat(cfg.Weight, 'f', -1, 64))
+	}
+	if cfg.MaxSize > 0 {
+		query.Set("maxsize", strconv.FormatFloat(cfg.MaxSize, 'f', -1, 64))
+	}
+	if cfg.Doorkeeper > 0 {
+		query.Set("doorkeeper", strconv.FormatUint(cfg.Doorkeeper, 10))
+	}
+	if cfg.AdmitProbability > 0 {
+		query.Set("admitprob", strconv.FormatFloat(cfg.AdmitProbability, 'f', -1, 64))
+	}
+	res, err := c.do(ctx, http.MethodPut, groupPath(ns), query, nil)
+	if err != nil {
+		return err
+	}
+	switch res.code {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return mecachis.NewDuplicatedGroupError(ns)
+	}
+	return res.statusError()
+}
+
+// Group returns the description of the group ns
+func (c *Client) Group(ctx context.Context, ns string) (*GroupInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, groupPath(ns), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch res.code {
+	case http.StatusOK:
+		info := new(GroupInfo)
+		if err := json.Unmarshal(res.body, info); err != nil {
+			return nil, err
+		}
+		return info, nil
+	case http.StatusNotFound:
+		return nil, mecachis.NewGroupNotFoundError(ns)
+	}
+	return nil, res.statusError()
+}
+
+// DeleteGroup drops the group ns along with all of its keys
+func (c *Client) DeleteGroup(ctx context.Context, ns string) error {
+	res, err := c.do(ctx, http.MethodDelete, groupPath(ns), nil, nil)
+	if err != nil {
+		return err
+	}
+	switch res.code {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return mecachis.NewGroupNotFoundError(ns)
+	}
+	return res.statusError()
+}
+
+type response struct {
+	code   int
+	header http.Header
+	body   []byte
+}
+
+func (r *response) statusError() error {
+	return &StatusError{Code: r.code, Body: strings.TrimSpace(string(r.body))}
+}
+
+// writeError maps the statuses writes of key are rejected with to the
+// errors of the hub: 413 for values too large and 507 for those not
+// admitted, the response telling why
+func (r *response) writeError(key string) error {
+	switch r.code {
+	case http.StatusRequestEntityTooLarge:
+		return mecachis.NewTooLargeError("'"+key+"'", 0)
+	case http.StatusInsufficientStorage:
+		reason := strings.TrimSpace(string(r.body))
+		if reason == "" {
+			reason = http.StatusText(r.code)
+		}
+		return mecachis.NewNotAdmittedError(key, reason)
+	}
+	return r.statusError()
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, payload []byte) (*response, error) {
+	return c.doWith(ctx, method, path, query, nil, payload)
+}
+
+// conditionalHeaders make writes depend on the current state of the key
+var conditionalHeaders = []string{mecachis.IfVersionHeader, "If-Match", "If-None-Match", "If-Unmodified-Since"}
+
+// retryable tells whether the request may be sent again, having the same
+// effect as sending it once. Conditional writes may not: had the first
+// attempt gone through, the retry would fail its precondition
+func retryable(method string, header http.Header) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPut, http.MethodDelete:
+		for _, name := range conditionalHeaders {
+			if header.Get(name) != "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// doWith performs the request, retrying those which are retryable on
+// transport errors and 5xx responses. The response body is fully read so that the
+// connection can be reused
+func (c *Client) doWith(ctx context.Context, method, path string, query url.Values, header http.Header, payload []byte) (*response, error) {
+	uri := c.endpoint + path
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	backoff := c.backoff
+	var res *response
+	var err error
+	for attempt := 0; ; attempt++ {
+		res, err = c.attempt(ctx, method, uri, header, payload)
+		// 507 means the write was refused for good, retrying would not help
+		if err == nil && (res.code < http.StatusInternalServerError || res.code == http.StatusInsufficientStorage) {
+			return res, nil
+		}
+		if attempt >= c.retries || !retryable(method, header) || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return res, err
+}
+
+func (c *Client) attempt(ctx context.Context, method, uri string, header http.Header, payload []byte) (*response, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{code: res.StatusCode, header: res.Header, body: content}, nil
+}
+
+func batchHeader() http.Header {
+	return http.Header{"Content-Type": {batch.ContentType}}
+}
+
+func groupPath(ns string) string {
+	return basePath + url.PathEscape(ns)
+}
+
+func keyPath(ns, key string) string {
+	return groupPath(ns) + "/" + url.PathEscape(key)
+}
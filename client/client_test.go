@@ -0,0 +1,306 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/sonirico/mecachis"
+	"github.com/sonirico/mecachis/batch"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(mecachis.NewHub(mecachis.WithLogger(mecachis.NopLogger())))
+	t.Cleanup(server.Close)
+	return New(server.URL, WithTimeout(time.Second))
+}
+
+func TestClient_AddGet(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if err := c.Add(ctx, "metrics", "cpu", []byte("98%")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	value, err := c.Get(ctx, "metrics", "cpu")
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	if !bytes.Equal(value, []byte("98%")) {
+		t.Errorf("unexpected value. want '98%%', have '%s'", value)
+	}
+}
+
+func TestClient_Add_Duplicated(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	_ = c.Add(ctx, "metrics", "cpu", []byte("98%"))
+	err := c.Add(ctx, "metrics", "cpu", []byte("12%"))
+	var dup *mecachis.ErrDuplicatedKey
+	if !errors.As(err, &dup) {
+		t.Errorf("unexpected error. want ErrDuplicatedKey, have %v", err)
+	}
+}
+
+func TestClient_Get_NotFound(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.Get(context.Background(), "metrics", "cpu")
+	var notFound *mecachis.ErrKeyNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("unexpected error. want ErrKeyNotFound, have %v", err)
+	}
+}
+
+func TestClient_Set_Overwrites(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	_ = c.Add(ctx, "metrics", "cpu", []byte("98%"))
+	if err := c.Set(ctx, "metrics", "cpu", []byte("12%")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	value, _ := c.Get(ctx, "metrics", "cpu")
+	if !bytes.Equal(value, []byte("12%")) {
+		t.Errorf("unexpected value. want '12%%', have '%s'", value)
+	}
+}
+
+func TestClient_Delete(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	_ = c.Add(ctx, "metrics", "cpu", []byte("98%"))
+	if err := c.Delete(ctx, "metrics", "cpu"); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var notFound *mecachis.ErrKeyNotFound
+	if _, err := c.Get(ctx, "metrics", "cpu"); !errors.As(err, &notFound) {
+		t.Errorf("unexpected error. want ErrKeyNotFound, have %v", err)
+	}
+	if err := c.Delete(ctx, "metrics", "cpu"); !errors.As(err, &notFound) {
+		t.Errorf("unexpected error. want ErrKeyNotFound, have %v", err)
+	}
+}
+
+func TestClient_Groups(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if err := c.CreateGroup(ctx, "metrics", GroupConfig{Capacity: 64, Engine: "lru", Shards: 4}); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var dup *mecachis.ErrDuplicatedGroup
+	if err := c.CreateGroup(ctx, "metrics", GroupConfig{}); !errors.As(err, &dup) {
+		t.Errorf("unexpected error. want ErrDuplicatedGroup, have %v", err)
+	}
+	_ = c.Add(ctx, "metrics", "cpu", []byte("98%"))
+	info, err := c.Group(ctx, "metrics")
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	want := GroupInfo{Ns: "metrics", Cap: 64, Engine: "lru", Shards: 4, Size: 6}
+	if *info != want {
+		t.Errorf("unexpected group info. want %+v, have %+v", want, *info)
+	}
+	if err := c.DeleteGroup(ctx, "metrics"); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var notFound *mecachis.ErrGroupNotFound
+	if _, err := c.Group(ctx, "metrics"); !errors.As(err, &notFound) {
+		t.Errorf("unexpected error. want ErrGroupNotFound, have %v", err)
+	}
+}
+
+func TestClient_Compression(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"gzip", "zstd", "snappy"} {
+		if err := c.CreateGroup(ctx, name, GroupConfig{Codec: name}); err != nil {
+			t.Fatalf("unexpected error. want nil, have %v", err)
+		}
+		value := bytes.Repeat([]byte(`{"cpu":98,"mem":"13gb"},`), 32)
+		_ = c.Add(ctx, name, "host", value)
+		have, err := c.Get(ctx, name, "host")
+		if err != nil || !bytes.Equal(have, value) {
+			t.Errorf("unexpected value for codec %s. want '%s', have '%s', %v", name, value, have, err)
+		}
+		info, _ := c.Group(ctx, name)
+		if info.Codec != name || info.Size >= uint64(len("host")+len(value)) {
+			t.Errorf("unexpected group info for codec %s. have %+v", name, *info)
+		}
+	}
+}
+
+func TestClient_RetriesOnServerError(t *testing.T) {
+	var calls int32
+	hub := mecachis.NewHub()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		hub.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithRetries(2, time.Millisecond))
+	if err := c.Set(context.Background(), "metrics", "cpu", []byte("98%")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of attempts. want 3, have %d", calls)
+	}
+}
+
+func TestClient_NoRetriesOnPost(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithRetries(2, time.Millisecond))
+	var statusErr *StatusError
+	if err := c.Add(context.Background(), "metrics", "cpu", []byte("98%")); !errors.As(err, &statusErr) {
+		t.Errorf("unexpected error. want StatusError, have %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected number of attempts. want 1 as adding is not idempotent, have %d", calls)
+	}
+}
+
+func TestClient_GivesUpAfterRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithRetries(1, time.Millisecond))
+	_, err := c.Get(context.Background(), "metrics", "cpu")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected error. want StatusError 500, have %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of attempts. want 2, have %d", calls)
+	}
+}
+
+func TestClient_NoRetriesOnCompareAndSwap(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithRetries(2, time.Millisecond))
+	_ = c.CompareAndSwap(context.Background(), "metrics", "cpu", 1, []byte("98%"))
+	if calls != 1 {
+		t.Errorf("unexpected number of attempts. want 1 as conditional writes are not idempotent, have %d", calls)
+	}
+}
+
+func TestClient_Timeout_SharedHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	shared := &http.Client{}
+	c := New(server.URL, WithHTTPClient(shared), WithTimeout(20*time.Millisecond), WithRetries(0, 0))
+	if shared.Timeout != 0 {
+		t.Errorf("unexpected timeout of the shared client. want 0, have %v", shared.Timeout)
+	}
+	if _, err := c.Get(context.Background(), "metrics", "cpu"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error. want context.DeadlineExceeded, have %v", err)
+	}
+}
+
+func TestClient_Rejected(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	_ = c.CreateGroup(ctx, "metrics", GroupConfig{Capacity: 64, Doorkeeper: 8})
+
+	var notAdmitted *mecachis.ErrNotAdmitted
+	if err := c.Set(ctx, "metrics", "cpu", []byte("98%")); !errors.As(err, &notAdmitted) {
+		t.Errorf("unexpected error. want ErrNotAdmitted, have %v", err)
+	}
+	var tooLarge *mecachis.ErrTooLarge
+	if err := c.Add(ctx, "metrics", "mem", []byte(strings.Repeat("9", 128))); !errors.As(err, &tooLarge) {
+		t.Errorf("unexpected error. want ErrTooLarge, have %v", err)
+	}
+	errs, err := c.AddMany(ctx, "metrics", []batch.Pair{{Key: "disk", Value: []byte(strings.Repeat("9", 128))}})
+	if err != nil || !errors.As(errs[0], &tooLarge) {
+		t.Errorf("unexpected error. want ErrTooLarge, have %v, %v", errs, err)
+	}
+}
+
+func TestClient_AddManyGetMany(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	_ = c.Add(ctx, "metrics", "cpu", []byte("98%"))
+	errs, err := c.AddMany(ctx, "metrics", []batch.Pair{
+		{Key: "mem", Value: []byte("13gb")},
+		{Key: "cpu", Value: []byte("12%")},
+		{Key: "ping", Value: []byte("10ms")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var dup *mecachis.ErrDuplicatedKey
+	if errs[0] != nil || !errors.As(errs[1], &dup) || errs[2] != nil {
+		t.Errorf("unexpected per-key errors. want [nil ErrDuplicatedKey nil], have %v", errs)
+	}
+
+	values, err := c.GetMany(ctx, "metrics", []string{"cpu", "disk", "ping"})
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	want := map[string][]byte{"cpu": []byte("98%"), "ping": []byte("10ms")}
+	if !reflect.DeepEqual(want, values) {
+		t.Errorf("unexpected values. want %q, have %q", want, values)
+	}
+}
+
+func TestClient_CompareAndSwap(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if err := c.CompareAndSwap(ctx, "metrics", "cpu", 0, []byte("98%")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	value, version, err := c.GetVersion(ctx, "metrics", "cpu")
+	if err != nil || string(value) != "98%" || version == 0 {
+		t.Fatalf("unexpected versioned value. have '%s' at %d, err %v", value, version, err)
+	}
+	if err := c.Set(ctx, "metrics", "cpu", []byte("12%")); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var failed *mecachis.ErrPreconditionFailed
+	if err := c.CompareAndSwap(ctx, "metrics", "cpu", version, []byte("50%")); !errors.As(err, &failed) {
+		t.Errorf("unexpected error. want ErrPreconditionFailed, have %v", err)
+	}
+	_, latest, _ := c.GetVersion(ctx, "metrics", "cpu")
+	if err := c.CompareAndSwap(ctx, "metrics", "cpu", latest, []byte("50%")); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	value := bytes.Repeat([]byte(`{"host":"db-1","cpu":98,"mem":"13gb"},`), 64)
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			c, ok := Lookup(name)
+			if !ok {
+				t.Fatalf("expected codec '%s' to be registered", name)
+			}
+			if c.Name() != name {
+				t.Errorf("unexpected codec name. want '%s', have '%s'", name, c.Name())
+			}
+			encoded, err := c.Encode(value)
+			if err != nil {
+				t.Fatalf("unexpected error. want nil, have %v", err)
+			}
+			if len(encoded) >= len(value) {
+				t.Errorf("expected value to shrink. want less than %d, have %d", len(value), len(encoded))
+			}
+			decoded, err := c.Decode(encoded)
+			if err != nil {
+				t.Fatalf("unexpected error. want nil, have %v", err)
+			}
+			if !bytes.Equal(decoded, value) {
+				t.Errorf("unexpected decoded value. have '%s'", decoded)
+			}
+		})
+	}
+}
+
+func TestCodec_Lookup_Unknown(t *testing.T) {
+	if _, ok := Lookup("brotli"); ok {
+		t.Errorf("unexpected codec 'brotli'")
+	}
+}
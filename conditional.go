@@ -0,0 +1,135 @@
+package mecachis
+
+import (
+	"fmt"
+	"github.com/sonirico/mecachis/codec"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// VersionHeader carries the compare-and-swap token of an item
+	VersionHeader = "X-Mecachis-Version"
+	// IfVersionHeader makes a write conditional on the current version of
+	// the key. Zero stands for a key which is not cached
+	IfVersionHeader = "X-Mecachis-If-Version"
+)
+
+// etagList splits the value of an If-Match or If-None-Match header
+func etagList(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// encodedETag returns the entity tag of the representation of a value
+// compressed with encoding. It differs from that of the value as written,
+// as their bytes do, so that ranges of both are never spliced together
+func encodedETag(tag, encoding string) string {
+	return strings.TrimSuffix(tag, `"`) + "-" + encoding + `"`
+}
+
+// identityETag returns the entity tag of the value as written for those of
+// its encoded representations, see encodedETag, and any other tag as is
+func identityETag(tag string) string {
+	i := strings.LastIndexByte(tag, '-')
+	if i < 0 || !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+	if _, ok := codec.Lookup(tag[i+1 : len(tag)-1]); !ok {
+		return tag
+	}
+	return tag[:i] + `"`
+}
+
+// writeETags splits the value of an If-Match or If-None-Match header of a
+// write. Writes replace the value whichever its representation, hence tags
+// of encoded ones stand for the value as written
+func writeETags(header string) []string {
+	tags := etagList(header)
+	for i, tag := range tags {
+		tags[i] = identityETag(tag)
+	}
+	return tags
+}
+
+// etagMatches compares tags strongly unless weak is given, in which case
+// the weakness indicator is ignored
+func etagMatches(tags []string, current string, weak bool) bool {
+	for _, tag := range tags {
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// writeValidators sets the headers clients revalidate the item with
+func writeValidators(w http.ResponseWriter, item *Item) {
+	w.Header().Set("ETag", item.ETag)
+	w.Header().Set("Last-Modified", item.Modified.UTC().Format(http.TimeFormat))
+	w.Header().Set(VersionHeader, strconv.FormatUint(item.Version(), 10))
+}
+
+// notModified tells whether the client copy of the item is still fresh,
+// tag being that of the representation served. If-Modified-Since is ignored
+// when If-None-Match is present
+func notModified(r *http.Request, item *Item, tag string) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(etagList(header), tag, true)
+	}
+	header := r.Header.Get("If-Modified-Since")
+	if header == "" {
+		return false
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	// Last-Modified has a resolution of seconds
+	return !item.Modified.Truncate(time.Second).After(since)
+}
+
+// writeCondition translates If-Match, If-None-Match and the version header
+// into a condition on the item currently cached. Returns nil if the request
+// is unconditional
+func writeCondition(r *http.Request) (Condition, error) {
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	rawVersion := r.Header.Get(IfVersionHeader)
+	if ifMatch == "" && ifNoneMatch == "" && rawVersion == "" {
+		return nil, nil
+	}
+	var ifVersion Condition
+	if rawVersion != "" {
+		version, err := strconv.ParseUint(rawVersion, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", IfVersionHeader, err)
+		}
+		ifVersion = versionIs(version)
+	}
+	return func(current *Item) bool {
+		if ifVersion != nil && !ifVersion(current) {
+			return false
+		}
+		if ifMatch != "" && (current == nil || !etagMatches(writeETags(ifMatch), current.ETag, false)) {
+			return false
+		}
+		if ifNoneMatch != "" && current != nil && etagMatches(writeETags(ifNoneMatch), current.ETag, true) {
+			return false
+		}
+		return true
+	}, nil
+}
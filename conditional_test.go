@@ -0,0 +1,160 @@
+package mecachis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func conditionalRequest(hub *Hub, method, endpoint, payload string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, endpoint, strings.NewReader(payload))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	hub.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHub_ServeHTTP_Get_Validators(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", "perfdata: 100%", nil)
+	tag := etag([]byte("perfdata: 100%"))
+
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", nil)
+	if recorder.Header().Get("ETag") != tag {
+		t.Errorf("unexpected ETag. want %s, have %s", tag, recorder.Header().Get("ETag"))
+	}
+	modified, err := http.ParseTime(recorder.Header().Get("Last-Modified"))
+	if err != nil || time.Since(modified) > time.Minute {
+		t.Errorf("unexpected Last-Modified. have '%s'", recorder.Header().Get("Last-Modified"))
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "matching If-None-Match", headers: map[string]string{"If-None-Match": tag}, wantStatus: http.StatusNotModified},
+		{name: "weak If-None-Match", headers: map[string]string{"If-None-Match": `"x", W/` + tag}, wantStatus: http.StatusNotModified},
+		{name: "stale If-None-Match", headers: map[string]string{"If-None-Match": `"x"`}, wantStatus: http.StatusOK},
+		{name: "fresh If-Modified-Since", headers: map[string]string{"If-Modified-Since": future}, wantStatus: http.StatusNotModified},
+		{name: "stale If-Modified-Since", headers: map[string]string{"If-Modified-Since": past}, wantStatus: http.StatusOK},
+		{
+			name:       "If-None-Match takes precedence",
+			headers:    map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": future},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", test.headers)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d", test.wantStatus, recorder.Code)
+			}
+			if recorder.Code == http.StatusNotModified && recorder.Body.Len() > 0 {
+				t.Errorf("unexpected body on 304. have '%s'", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_ConditionalWrites(t *testing.T) {
+	tag := etag([]byte("perfdata: 100%"))
+	tests := []struct {
+		name       string
+		method     string
+		headers    map[string]string
+		wantStatus int
+		wantValue  string
+	}{
+		{
+			name:       "set with matching If-Match",
+			method:     http.MethodPut,
+			headers:    map[string]string{"If-Match": tag},
+			wantStatus: http.StatusNoContent,
+			wantValue:  "perfdata: 99%",
+		},
+		{
+			name:       "set with stale If-Match",
+			method:     http.MethodPut,
+			headers:    map[string]string{"If-Match": `"stale"`},
+			wantStatus: http.StatusPreconditionFailed,
+			wantValue:  "perfdata: 100%",
+		},
+		{
+			name:       "set with If-None-Match on existent key",
+			method:     http.MethodPut,
+			headers:    map[string]string{"If-None-Match": "*"},
+			wantStatus: http.StatusPreconditionFailed,
+			wantValue:  "perfdata: 100%",
+		},
+		{
+			name:       "remove with stale If-Match",
+			method:     http.MethodDelete,
+			headers:    map[string]string{"If-Match": `"stale"`},
+			wantStatus: http.StatusPreconditionFailed,
+			wantValue:  "perfdata: 100%",
+		},
+		{
+			name:       "remove with matching If-Match",
+			method:     http.MethodDelete,
+			headers:    map[string]string{"If-Match": tag},
+			wantStatus: http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewHub(WithLogger(NopLogger()))
+			conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", "perfdata: 100%", nil)
+
+			recorder := conditionalRequest(hub, test.method, "/mecachis/monitoring/sla", "perfdata: 99%", test.headers)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d", test.wantStatus, recorder.Code)
+			}
+			g, _ := hub.group("monitoring")
+			value, _ := g.Get("sla")
+			if value.String() != test.wantValue {
+				t.Errorf("unexpected cache result. want '%s', have '%s'", test.wantValue, value.String())
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_IfMatch_NonExistentKey(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	headers := map[string]string{"If-Match": "*"}
+	recorder := conditionalRequest(hub, http.MethodPut, "/mecachis/monitoring/sla", "perfdata: 99%", headers)
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusPreconditionFailed, recorder.Code)
+	}
+}
+
+func TestHub_ServeHTTP_IfVersion(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", "perfdata: 100%", nil)
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", nil)
+	version := recorder.Header().Get(VersionHeader)
+	if version == "" || version == "0" {
+		t.Fatalf("expected a version header. have '%s'", version)
+	}
+
+	headers := map[string]string{IfVersionHeader: version}
+	recorder = conditionalRequest(hub, http.MethodPut, "/mecachis/monitoring/sla", "perfdata: 99%", headers)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusNoContent, recorder.Code)
+	}
+	recorder = conditionalRequest(hub, http.MethodPut, "/mecachis/monitoring/sla", "perfdata: 98%", headers)
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusPreconditionFailed, recorder.Code)
+	}
+	headers = map[string]string{IfVersionHeader: "latest"}
+	recorder = conditionalRequest(hub, http.MethodDelete, "/mecachis/monitoring/sla", "", headers)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusBadRequest, recorder.Code)
+	}
+}
@@ -0,0 +1,300 @@
+package engines
+
+import (
+	"container/list"
+	"github.com/sonirico/mecachis/engines"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// how many read buffers hits are spread over. Must be a power of two
+	stripes = 16
+	// how many hits each read buffer holds. Must be a power of two
+	bufferSize = 64
+	// how many pending hits make a reader try to drain a buffer
+	drainThreshold = bufferSize / 2
+)
+
+// readBuffer is a lossy, bounded, multiple producer single consumer ring
+// of hits. Producers never block: hits are dropped when the ring is full
+type readBuffer struct {
+	head  uint32
+	tail  uint32
+	slots [bufferSize]unsafe.Pointer
+}
+
+// record returns how many hits are pending, or -1 if the hit was dropped
+func (b *readBuffer) record(el *list.Element) int {
+	head := atomic.LoadUint32(&b.head)
+	tail := atomic.LoadUint32(&b.tail)
+	pending := tail - head
+	if pending >= bufferSize {
+		return -1
+	}
+	if !atomic.CompareAndSwapUint32(&b.tail, tail, tail+1) {
+		return -1
+	}
+	atomic.StorePointer(&b.slots[tail&(bufferSize-1)], unsafe.Pointer(el))
+	return int(pending + 1)
+}
+
+// drain must only be called by one consumer at a time
+func (b *readBuffer) drain(fn func(el *list.Element)) {
+	head := atomic.LoadUint32(&b.head)
+	tail := atomic.LoadUint32(&b.tail)
+	for ; head != tail; head++ {
+		slot := &b.slots[head&(bufferSize-1)]
+		p := atomic.SwapPointer(slot, nil)
+		if p == nil {
+			// The producer has not published the hit yet
+			break
+		}
+		fn((*list.Element)(p))
+	}
+	atomic.StoreUint32(&b.head, head)
+}
+
+// blru is an lru whose reads do not need exclusive access. Hits are recorded
+// into read buffers and replayed in batches under the lock, so the recency
+// order is only approximately lru: hits dropped because of a full buffer
+// are not accounted for
+type blru struct {
+	mx sync.RWMutex
+
+	// how many bytes and entries fit in
+	capacity  engines.Capacity
+	size      uint64
+	list      *list.List
+	cache     map[string]*list.Element
+	pins      engines.Pins
+	onEvicted engines.EvictionFn
+
+	draining int32
+	buffers  [stripes]readBuffer
+}
+
+// New initializes a new cache by providing the maximum capacity in bytes
+// which, once reached, will provoke to evict the lru element
+func New(capacity uint64) *blru {
+	return NewBounded(engines.Capacity{Bytes: capacity})
+}
+
+// NewBounded initializes a new cache bounded by bytes, entries or both
+func NewBounded(capacity engines.Capacity) *blru {
+	return &blru{
+		capacity: capacity,
+		list:     list.New(),
+		cache:    make(map[string]*list.Element),
+	}
+}
+
+// Concurrent tells callers that the engine needs no external locking
+func (c *blru) Concurrent() {}
+
+func (c *blru) OnEvict(onEvicted engines.EvictionFn) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.onEvicted = onEvicted
+}
+
+// drainBuffers replays pending hits. Callers must hold the write lock
+func (c *blru) drainBuffers() {
+	promote := func(el *list.Element) {
+		// MoveToFront is a no-op for elements removed in the meantime
+		c.list.MoveToFront(el)
+	}
+	for i := range c.buffers {
+		c.buffers[i].drain(promote)
+	}
+}
+
+// tryDrain drains the buffers unless another goroutine is doing it already
+func (c *blru) tryDrain() {
+	if !atomic.CompareAndSwapInt32(&c.draining, 0, 1) {
+		return
+	}
+	c.mx.Lock()
+	c.drainBuffers()
+	c.mx.Unlock()
+	atomic.StoreInt32(&c.draining, 0)
+}
+
+// evict drops the lru element which is not pinned. Returns whether there
+// was any. Callers must hold the write lock
+func (c *blru) evict() bool {
+	el := c.list.Back()
+	for el != nil && c.pins.Has(el.Value.(engines.Entry).Key()) {
+		el = el.Prev()
+	}
+	if el == nil {
+		return false
+	}
+	c.list.Remove(el)
+	entry := el.Value.(engines.Entry)
+	delete(c.cache, entry.Key())
+	c.size -= entry.Len()
+	if c.onEvicted != nil {
+		c.onEvicted(entry)
+	}
+	return true
+}
+
+// Insert puts a key-value pair into the cache. Returns whether the pair
+// was inserted. `false` means that the element was cached already or that
+// it is larger than the capacity, in which case nothing is evicted
+func (c *blru) Insert(key string, value engines.Value) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if el, ok := c.cache[key]; ok {
+		c.list.MoveToFront(el)
+		return false
+	}
+	// Account for pending hits before choosing whom to evict
+	c.drainBuffers()
+	entry := engines.NewEntry(key, value)
+	if !c.capacity.Fits(entry.Len()) {
+		return false
+	}
+	el := c.list.PushFront(entry)
+	c.cache[key] = el
+	c.size += entry.Len()
+	if engines.PinOnInsert(value) {
+		c.pins.Add(key, entry.Len())
+	}
+	// Pinned elements may keep the capacity exceeded
+	for c.capacity.Exceeded(c.size, uint64(len(c.cache))) && c.evict() {
+	}
+	return true
+}
+
+// Access returns an element by key if it is within the cache already. The
+// hit is recorded to be replayed later on rather than moving the element
+// right away
+func (c *blru) Access(key string) (engines.Value, bool) {
+	c.mx.RLock()
+	el, ok := c.cache[key]
+	var value engines.Value
+	if ok {
+		entry := el.Value.(engines.Entry)
+		entry.Touch()
+		value = entry.Value()
+	}
+	c.mx.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	buffer := &c.buffers[engines.HashKey(key)&(stripes-1)]
+	if pending := buffer.record(el); pending < 0 || pending >= drainThreshold {
+		c.tryDrain()
+	}
+	return value, true
+}
+
+// Peek returns an element by key without recording a hit
+func (c *blru) Peek(key string) (engines.Value, bool) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	el, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(engines.Entry).Value(), true
+}
+
+// Inspect describes an element by key without recording a hit
+func (c *blru) Inspect(key string) (engines.Info, bool) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	el, ok := c.cache[key]
+	if !ok {
+		return engines.Info{}, false
+	}
+	info := el.Value.(engines.Entry).Info()
+	info.Pinned = c.pins.Has(key)
+	return info, true
+}
+
+// Remove deletes an element by key. Returns whether the element was
+// in the cache. The eviction hook is not called for explicit removals
+func (c *blru) Remove(key string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	el, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.list.Remove(el)
+	delete(c.cache, key)
+	c.size -= el.Value.(engines.Entry).Len()
+	c.pins.Remove(key)
+	return true
+}
+
+// Evict drops the lru element which is not pinned, as if room was needed.
+// Returns whether there was any
+func (c *blru) Evict() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.drainBuffers()
+	return c.evict()
+}
+
+// Pin exempts an element from eviction. Returns whether the element is in
+// the cache
+func (c *blru) Pin(key string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	el, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.pins.Add(key, el.Value.(engines.Entry).Len())
+	return true
+}
+
+// Unpin makes an element evictable again. Returns whether it was pinned
+func (c *blru) Unpin(key string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.pins.Remove(key)
+}
+
+// Pinned returns how many bytes pinned elements take
+func (c *blru) Pinned() uint64 {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.pins.Size()
+}
+
+// Size returns the current length of the cache
+func (c *blru) Size() uint64 {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.size
+}
+
+// Dump returns the current state of the cache, after replaying pending hits
+func (c *blru) Dump() []engines.Entry {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.drainBuffers()
+	var result []engines.Entry
+	for el := c.list.Front(); el != nil; el = el.Next() {
+		result = append(result, el.Value.(engines.Entry))
+	}
+	return result
+}
+
+// Scan returns up to count entries whose keys match pattern, following
+// cursor, along with the cursor of the next page. See engines.Page
+func (c *blru) Scan(cursor string, count int, pattern string) ([]engines.Entry, string) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	page := engines.NewPage(cursor, count, pattern)
+	for _, el := range c.cache {
+		page.Offer(el.Value.(engines.Entry))
+	}
+	return page.Entries()
+}
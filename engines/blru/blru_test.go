@@ -0,0 +1,168 @@
+package engines
+
+import (
+	"fmt"
+	"github.com/sonirico/mecachis/engines"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type cachevalue string
+
+func (v cachevalue) Value() interface{} {
+	return v
+}
+
+func (v cachevalue) Len() uint64 {
+	return uint64(len(v))
+}
+
+func keys(entries []engines.Entry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Key()
+	}
+	return result
+}
+
+func TestCacheBLRU_EvictsLRUIfExceedingCapacity_Insert(t *testing.T) {
+	cache := New(6)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.Insert(key, cachevalue("1")) // +2
+	}
+	if cache.Size() != 6 {
+		t.Errorf("wrong cache size. want %d. have %d", 6, cache.Size())
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"d", "c", "b"}) {
+		t.Errorf("unexpected cache state. want [d c b], have %v", have)
+	}
+}
+
+func TestCacheBLRU_EvictsLRUIfExceedingEntries_Insert(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Bytes: 64, Entries: 2})
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Insert(key, cachevalue("1"))
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"c", "b"}) {
+		t.Errorf("unexpected cache state. want [c b], have %v", have)
+	}
+}
+
+func TestCacheBLRU_Access_ReplaysHitsBeforeEvicting(t *testing.T) {
+	evicted := make([]string, 0)
+	cache := New(6)
+	cache.OnEvict(func(entry engines.Entry) {
+		evicted = append(evicted, entry.Key())
+	})
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Insert("c", cachevalue("3"))
+	value, ok := cache.Access("a") // recorded, but not applied yet
+	if !ok || value.(cachevalue) != "1" {
+		t.Errorf("wrong cachevalue returned. want '%s', have '%v'", "1", value)
+	}
+	cache.Insert("d", cachevalue("4")) // replays the hit on "a", hence "b" goes away
+	if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("wrong set of elements have been evicted. want [b], have %v", evicted)
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"d", "a", "c"}) {
+		t.Errorf("unexpected cache state. want [d a c], have %v", have)
+	}
+}
+
+func TestCacheBLRU_Peek_RecordsNoHit(t *testing.T) {
+	cache := New(6)
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Insert("c", cachevalue("3"))
+	value, ok := cache.Peek("a")
+	if !ok || value.(cachevalue) != "1" {
+		t.Errorf("wrong cachevalue returned. want '%s', have '%v'", "1", value)
+	}
+	cache.Insert("d", cachevalue("4"))
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"d", "c", "b"}) {
+		t.Errorf("unexpected cache state. want [d c b], have %v", have)
+	}
+}
+
+func TestCacheBLRU_Pin_SkipsEviction(t *testing.T) {
+	cache := New(6)
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Insert("c", cachevalue("3"))
+	cache.Pin("a")
+	cache.Pin("b")
+	cache.Insert("d", cachevalue("4"))
+	cache.Insert("e", cachevalue("5"))
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"e", "b", "a"}) {
+		t.Errorf("unexpected cache state. want [e b a], have %v", have)
+	}
+	if info, _ := cache.Inspect("a"); !info.Pinned || cache.Pinned() != 4 {
+		t.Errorf("unexpected pins. want 'a' pinned out of 4 bytes, have %+v and %d", info, cache.Pinned())
+	}
+}
+
+func TestCacheBLRU_Remove(t *testing.T) {
+	cache := New(32)
+	cache.Insert("a", cachevalue("1"))
+	cache.Access("a")
+	if !cache.Remove("a") {
+		t.Errorf("expected successful removal. want %t, have %t", true, false)
+	}
+	if _, ok := cache.Access("a"); ok {
+		t.Errorf("expected removed element to be missing")
+	}
+	if cache.Size() != 0 || len(cache.Dump()) != 0 {
+		t.Errorf("expected empty cache. have size %d", cache.Size())
+	}
+}
+
+func TestCacheBLRU_Concurrent(t *testing.T) {
+	cache := New(128)
+	var wg sync.WaitGroup
+	workers := 8
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("%d", i%100)
+				if i%10 == 0 {
+					cache.Insert(key, cachevalue("value"))
+					continue
+				}
+				if i%25 == 0 {
+					cache.Remove(key)
+					continue
+				}
+				cache.Access(key)
+			}
+		}()
+	}
+	wg.Wait()
+	var size uint64
+	for _, entry := range cache.Dump() {
+		size += entry.Len()
+	}
+	if size != cache.Size() || size > 128 {
+		t.Errorf("inconsistent cache size. want %d, have %d", size, cache.Size())
+	}
+}
+
+func BenchmarkCacheBLRU_Access_Parallel(b *testing.B) {
+	cache := New(0)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		cache.Insert(keys[i], cachevalue("value"))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Access(keys[i%len(keys)])
+			i++
+		}
+	})
+}
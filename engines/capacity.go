@@ -0,0 +1,25 @@
+package engines
+
+// Capacity bounds an engine by the bytes its entries take, by how many
+// entries it holds or both. Zero means no bound
+type Capacity struct {
+	Bytes   uint64
+	Entries uint64
+}
+
+// Exceeded tells whether an engine holding entries which take size bytes
+// is over capacity
+func (c Capacity) Exceeded(size, entries uint64) bool {
+	return c.Bytes > 0 && size > c.Bytes || c.Entries > 0 && entries > c.Entries
+}
+
+// Fits tells whether an entry taking size bytes may be held at all. Larger
+// ones would make the engine evict every other entry and then themselves
+func (c Capacity) Fits(size uint64) bool {
+	return c.Bytes == 0 || size <= c.Bytes
+}
+
+// Bounded tells whether there is any bound at all
+func (c Capacity) Bounded() bool {
+	return c.Bytes > 0 || c.Entries > 0
+}
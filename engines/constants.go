@@ -7,10 +7,26 @@ const (
 	LFU
 	LFRU
 	MRU
+	BLRU
+	GDSF
 )
 
 var cacheTypes = map[string]CacheType{
-	"lru": LRU,
+	"lru":  LRU,
+	"lfu":  LFU,
+	"lfru": LFRU,
+	"blru": BLRU,
+	"gdsf": GDSF,
+}
+
+// String returns the name by which the cache type can be looked up
+func (ct CacheType) String() string {
+	for name, candidate := range cacheTypes {
+		if candidate == ct {
+			return name
+		}
+	}
+	return "unknown"
 }
 
 func LookupCacheType(candidate string) (CacheType, bool) {
@@ -15,14 +15,66 @@ type Entry interface {
 
 	Key() string
 	Value() Value
+	Version() uint64
+	Touch()
+	Info() Info
+}
+
+// Versioned is implemented by values which carry a compare-and-swap token,
+// increasing every time a key is written
+type Versioned interface {
+	Version() uint64
+}
+
+// Costly is implemented by values which tell how expensive they are to
+// recompute, for cost-aware engines to keep the ones which save the most
+type Costly interface {
+	RecomputeCost() float64
+}
+
+// Pinnable is implemented by values which may ask to be pinned as they are
+// inserted, so that the room made for them never evicts them
+type Pinnable interface {
+	PinOnInsert() bool
+}
+
+// PinOnInsert tells whether the value asks to be pinned as it is inserted
+func PinOnInsert(value Value) bool {
+	pinnable, ok := value.(Pinnable)
+	return ok && pinnable.PinOnInsert()
 }
 
 type EvictionFn func(Entry)
 
 type Engine interface {
+	// Insert pins the key right away if the value asks to, see Pinnable
 	Insert(k string, v Value) bool
 	Access(k string) (Value, bool)
+	// Peek returns the value of the key like Access does, but leaves the
+	// policy state and the usage of the entry untouched
+	Peek(k string) (Value, bool)
+	// Inspect describes the entry of the key without touching it either
+	Inspect(k string) (Info, bool)
+	Remove(k string) bool
+	// Evict drops the next entry the policy would evict, skipping pinned
+	// ones, and calls the eviction hook. Returns whether there was any
+	Evict() bool
+	// Pin exempts the key from eviction until it is unpinned or removed.
+	// Returns whether the key is cached
+	Pin(k string) bool
+	// Unpin returns whether the key was pinned
+	Unpin(k string) bool
+	// Pinned returns how many bytes pinned keys take out of Size
+	Pinned() uint64
 	Size() uint64
 	Dump() []Entry
+	Scan(cursor string, count int, pattern string) ([]Entry, string)
 	OnEvict(fn EvictionFn)
 }
+
+// Concurrent is implemented by engines which are safe for concurrent use
+// and hence need no external locking on reads
+type Concurrent interface {
+	Engine
+	Concurrent()
+}
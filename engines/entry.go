@@ -1,12 +1,34 @@
 package engines
 
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Info describes how an entry has been used, as recorded by its engine
+type Info struct {
+	Size     uint64
+	Inserted time.Time
+	// Accessed is zero until the entry is first accessed
+	Accessed time.Time
+	// Accesses is how many times the entry was accessed, which is the
+	// frequency for lfu engines
+	Accesses uint64
+	Pinned   bool
+}
+
 type entry struct {
-	key   string
-	value Value
+	key      string
+	value    Value
+	inserted time.Time
+	// unix nanoseconds of the last access, written concurrently by engines
+	// whose reads take no exclusive lock
+	accessed int64
+	accesses uint64
 }
 
 func NewEntry(k string, v Value) *entry {
-	return &entry{key: k, value: v}
+	return &entry{key: k, value: v, inserted: time.Now()}
 }
 
 func (e *entry) Key() string {
@@ -17,6 +39,34 @@ func (e *entry) Value() Value {
 	return e.value
 }
 
+// Version returns the compare-and-swap token of the value, or zero if the
+// value is not versioned
+func (e *entry) Version() uint64 {
+	if v, ok := e.value.(Versioned); ok {
+		return v.Version()
+	}
+	return 0
+}
+
 func (e *entry) Len() uint64 {
 	return uint64(len(e.key)) + e.value.Len()
 }
+
+// Touch records an access. Safe for concurrent use
+func (e *entry) Touch() {
+	atomic.AddUint64(&e.accesses, 1)
+	atomic.StoreInt64(&e.accessed, time.Now().UnixNano())
+}
+
+// Info returns the usage of the entry so far. Safe for concurrent use
+func (e *entry) Info() Info {
+	info := Info{
+		Size:     e.Len(),
+		Inserted: e.inserted,
+		Accesses: atomic.LoadUint64(&e.accesses),
+	}
+	if accessed := atomic.LoadInt64(&e.accessed); accessed > 0 {
+		info.Accessed = time.Unix(0, accessed)
+	}
+	return info
+}
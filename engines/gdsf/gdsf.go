@@ -0,0 +1,281 @@
+package engines
+
+import (
+	"container/heap"
+	"github.com/sonirico/mecachis/engines"
+	"sort"
+)
+
+// node is an element of the cache along with its priority, which is the
+// inflation of the cache at the time the node was last touched plus its
+// frequency times its cost per byte
+type node struct {
+	entry     engines.Entry
+	cost      float64
+	frequency uint64
+	priority  float64
+	// tick breaks ties in favour of the least recently touched node
+	tick uint64
+	// index within the queue, -1 while the node is pinned
+	index int
+}
+
+// queue is a min-heap of nodes by priority
+type queue []*node
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	return q[i].tick < q[j].tick
+}
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x interface{}) {
+	n := x.(*node)
+	n.index = len(*q)
+	*q = append(*q, n)
+}
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	n.index = -1
+	*q = old[:len(old)-1]
+	return n
+}
+
+// gdsf implements GreedyDual-Size-Frequency: the element evicted is the one
+// which saves the least cost per byte, weighted by how often it is hit.
+// Every eviction inflates the priority of elements touched from then on,
+// so that elements which were valuable long ago age out
+type gdsf struct {
+	// how many bytes and entries fit in
+	capacity  engines.Capacity
+	size      uint64
+	inflation float64
+	tick      uint64
+	nodes     map[string]*node
+	queue     queue
+	pins      engines.Pins
+	onEvicted engines.EvictionFn
+}
+
+// New initializes a new cache by providing the maximum capacity in bytes
+// which, once reached, will provoke to evict the element with the lowest
+// priority
+func New(capacity uint64) *gdsf {
+	return NewBounded(engines.Capacity{Bytes: capacity})
+}
+
+// NewBounded initializes a new cache bounded by bytes, entries or both
+func NewBounded(capacity engines.Capacity) *gdsf {
+	return &gdsf{
+		capacity: capacity,
+		nodes:    make(map[string]*node),
+	}
+}
+
+func (c *gdsf) OnEvict(onEvicted engines.EvictionFn) {
+	c.onEvicted = onEvicted
+}
+
+// cost returns how expensive the value is to recompute. Values which do not
+// tell cost one
+func cost(value engines.Value) float64 {
+	if costly, ok := value.(engines.Costly); ok && costly.RecomputeCost() > 0 {
+		return costly.RecomputeCost()
+	}
+	return 1
+}
+
+// touch recomputes the priority of the node
+func (c *gdsf) touch(n *node) {
+	c.tick++
+	n.tick = c.tick
+	size := n.entry.Len()
+	if size < 1 {
+		size = 1
+	}
+	n.priority = c.inflation + float64(n.frequency)*n.cost/float64(size)
+}
+
+// evict drops the element with the lowest priority which is not pinned.
+// Returns whether there was any
+func (c *gdsf) evict() bool {
+	if len(c.queue) < 1 {
+		return false
+	}
+	n := heap.Pop(&c.queue).(*node)
+	c.inflation = n.priority
+	delete(c.nodes, n.entry.Key())
+	c.size -= n.entry.Len()
+	if c.onEvicted != nil {
+		c.onEvicted(n.entry)
+	}
+	return true
+}
+
+// Insert puts a key-value pair into the cache. Returns whether the pair
+// was inserted. `false` means that the element was cached already or that
+// it is larger than the capacity, in which case nothing is evicted
+func (c *gdsf) Insert(key string, value engines.Value) bool {
+	if _, ok := c.nodes[key]; ok {
+		return false
+	}
+	n := &node{entry: engines.NewEntry(key, value), cost: cost(value), frequency: 1}
+	if !c.capacity.Fits(n.entry.Len()) {
+		return false
+	}
+	// Room is made beforehand, so that the element is prioritised after the
+	// inflation of the evictions it causes
+	for c.capacity.Exceeded(c.size+n.entry.Len(), uint64(len(c.nodes))+1) && c.evict() {
+	}
+	c.touch(n)
+	c.nodes[key] = n
+	heap.Push(&c.queue, n)
+	c.size += n.entry.Len()
+	if engines.PinOnInsert(value) {
+		c.Pin(key)
+	}
+	// Elements larger than the room left by pinned ones go away
+	for c.capacity.Exceeded(c.size, uint64(len(c.nodes))) && c.evict() {
+	}
+	return true
+}
+
+// Access returns an element by key if it is within the cache already,
+// raising its frequency
+func (c *gdsf) Access(key string) (engines.Value, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return nil, false
+	}
+	n.frequency++
+	c.touch(n)
+	if n.index >= 0 {
+		heap.Fix(&c.queue, n.index)
+	}
+	n.entry.Touch()
+	return n.entry.Value(), true
+}
+
+// Peek returns an element by key, if cached, leaving its priority as it is
+func (c *gdsf) Peek(key string) (engines.Value, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return nil, false
+	}
+	return n.entry.Value(), true
+}
+
+// Inspect describes an element by key, if cached, leaving its priority as
+// it is
+func (c *gdsf) Inspect(key string) (engines.Info, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return engines.Info{}, false
+	}
+	info := n.entry.Info()
+	info.Pinned = c.pins.Has(key)
+	return info, true
+}
+
+// Remove deletes an element by key. Returns whether the element was
+// in the cache. The eviction hook is not called for explicit removals
+func (c *gdsf) Remove(key string) bool {
+	n, ok := c.nodes[key]
+	if !ok {
+		return false
+	}
+	if n.index >= 0 {
+		heap.Remove(&c.queue, n.index)
+	}
+	delete(c.nodes, key)
+	c.size -= n.entry.Len()
+	c.pins.Remove(key)
+	return true
+}
+
+// Evict drops the element with the lowest priority which is not pinned, as
+// if room was needed. Returns whether there was any
+func (c *gdsf) Evict() bool {
+	return c.evict()
+}
+
+// Pin exempts an element from eviction by taking it out of the queue.
+// Returns whether the element is in the cache
+func (c *gdsf) Pin(key string) bool {
+	n, ok := c.nodes[key]
+	if !ok {
+		return false
+	}
+	if n.index >= 0 {
+		heap.Remove(&c.queue, n.index)
+	}
+	c.pins.Add(key, n.entry.Len())
+	return true
+}
+
+// Unpin puts an element back into the queue, with the priority it would
+// have if inserted now. Returns whether it was pinned
+func (c *gdsf) Unpin(key string) bool {
+	if !c.pins.Remove(key) {
+		return false
+	}
+	n := c.nodes[key]
+	c.touch(n)
+	heap.Push(&c.queue, n)
+	return true
+}
+
+// Pinned returns how many bytes pinned elements take
+func (c *gdsf) Pinned() uint64 {
+	return c.pins.Size()
+}
+
+// Size returns the current length of the cache
+func (c *gdsf) Size() uint64 {
+	return c.size
+}
+
+// Dump returns the current state of the cache, from the element with the
+// highest priority to the next to be evicted. Pinned elements come first
+func (c *gdsf) Dump() []engines.Entry {
+	nodes := make([]*node, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if pi, pj := nodes[i].index < 0, nodes[j].index < 0; pi != pj {
+			return pi
+		}
+		if nodes[i].priority != nodes[j].priority {
+			return nodes[i].priority > nodes[j].priority
+		}
+		return nodes[i].tick > nodes[j].tick
+	})
+	result := make([]engines.Entry, len(nodes))
+	for i, n := range nodes {
+		result[i] = n.entry
+	}
+	return result
+}
+
+// Scan returns up to count entries whose keys match pattern, following
+// cursor, along with the cursor of the next page. See engines.Page
+func (c *gdsf) Scan(cursor string, count int, pattern string) ([]engines.Entry, string) {
+	page := engines.NewPage(cursor, count, pattern)
+	for _, n := range c.nodes {
+		page.Offer(n.entry)
+	}
+	return page.Entries()
+}
@@ -0,0 +1,135 @@
+package engines
+
+import (
+	"github.com/sonirico/mecachis/engines"
+	"reflect"
+	"testing"
+)
+
+type cachevalue struct {
+	data string
+	cost float64
+}
+
+func (v cachevalue) Value() interface{} {
+	return v.data
+}
+
+func (v cachevalue) Len() uint64 {
+	return uint64(len(v.data))
+}
+
+func (v cachevalue) RecomputeCost() float64 {
+	return v.cost
+}
+
+func keys(entries []engines.Entry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Key()
+	}
+	return result
+}
+
+func TestCacheGDSF_EvictsCheapest_Insert(t *testing.T) {
+	evicted := make([]string, 0)
+	cache := New(6)
+	cache.OnEvict(func(entry engines.Entry) {
+		evicted = append(evicted, entry.Key())
+	})
+	cache.Insert("a", cachevalue{"1", 10}) // +2
+	cache.Insert("b", cachevalue{"2", 1})  // +2
+	cache.Insert("c", cachevalue{"3", 5})  // +2
+	cache.Insert("d", cachevalue{"4", 20}) // +2, evicts the cheapest
+	if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("wrong set of elements have been evicted. want [b], have %v", evicted)
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"d", "a", "c"}) {
+		t.Errorf("unexpected cache state. want [d a c], have %v", have)
+	}
+	if cache.Size() != 6 {
+		t.Errorf("wrong cache size. want %d. have %d", 6, cache.Size())
+	}
+}
+
+func TestCacheGDSF_WeighsSize_Insert(t *testing.T) {
+	cache := New(11)
+	cache.Insert("a", cachevalue{"1234567", 4}) // +8, 0.5 per byte
+	cache.Insert("b", cachevalue{"1", 2})       // +2, 1 per byte
+	cache.Insert("c", cachevalue{"1", 1})       // +2, evicts "a" and inflates by 0.5
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"c", "b"}) {
+		t.Errorf("unexpected cache state. want [c b], have %v", have)
+	}
+}
+
+func TestCacheGDSF_EvictsCheapestIfExceedingEntries_Insert(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Entries: 2})
+	cache.Insert("a", cachevalue{"1", 10})
+	cache.Insert("b", cachevalue{"2", 1})
+	cache.Insert("c", cachevalue{"3", 5}) // evicts "b"
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"a", "c"}) {
+		t.Errorf("unexpected cache state. want [a c], have %v", have)
+	}
+}
+
+func TestCacheGDSF_Access_RaisesPriority(t *testing.T) {
+	cache := New(6)
+	cache.Insert("a", cachevalue{"1", 1})
+	cache.Insert("b", cachevalue{"2", 2})
+	cache.Insert("c", cachevalue{"3", 2})
+	cache.Access("a")
+	cache.Access("a")
+	cache.Access("a") // 4 hits of cost 1 outweigh 1 hit of cost 2
+	cache.Insert("d", cachevalue{"4", 2})
+	if _, ok := cache.Peek("a"); !ok {
+		t.Errorf("expected frequently accessed element to be kept")
+	}
+	if _, ok := cache.Peek("b"); ok {
+		t.Errorf("expected least valuable element to be evicted")
+	}
+}
+
+func TestCacheGDSF_Inflation_AgesOut(t *testing.T) {
+	cache := New(4)
+	cache.Insert("a", cachevalue{"1", 3}) // priority 1.5
+	for _, key := range []string{"b", "c", "d", "e"} {
+		// Every eviction inflates the priority of the elements inserted
+		// afterwards, until they outweigh "a"
+		cache.Insert(key, cachevalue{"1", 1})
+	}
+	if _, ok := cache.Peek("a"); ok {
+		t.Errorf("expected stale valuable element to age out")
+	}
+}
+
+func TestCacheGDSF_Pin(t *testing.T) {
+	cache := New(4)
+	cache.Insert("a", cachevalue{"1", 1})
+	cache.Pin("a")
+	cache.Insert("b", cachevalue{"2", 10})
+	cache.Insert("c", cachevalue{"3", 10}) // evicts "b" as "a" is pinned
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"a", "c"}) {
+		t.Errorf("unexpected cache state. want [a c], have %v", have)
+	}
+	cache.Unpin("a")
+	cache.Insert("d", cachevalue{"4", 10})
+	if _, ok := cache.Peek("a"); ok {
+		t.Errorf("expected unpinned element to be evicted")
+	}
+}
+
+func TestCacheGDSF_Remove(t *testing.T) {
+	cache := New(32)
+	cache.Insert("a", cachevalue{"1", 1})
+	cache.Insert("b", cachevalue{"2", 1})
+	cache.Pin("b")
+	if !cache.Remove("a") || !cache.Remove("b") {
+		t.Errorf("expected successful removal. want %t, have %t", true, false)
+	}
+	if cache.Remove("a") {
+		t.Errorf("expected no removal. want %t, have %t", false, true)
+	}
+	if cache.Size() != 0 || cache.Pinned() != 0 || len(cache.Dump()) != 0 {
+		t.Errorf("expected empty cache. have size %d", cache.Size())
+	}
+}
@@ -0,0 +1,16 @@
+package engines
+
+// HashKey returns the 32 bits FNV-1a hash of the key. Unlike hash/fnv, it
+// does not allocate
+func HashKey(key string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	hash := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
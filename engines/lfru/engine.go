@@ -0,0 +1,308 @@
+package engines
+
+import (
+	"container/list"
+	"github.com/sonirico/mecachis/engines"
+)
+
+// bucket holds the unprivileged nodes accessed the same number of times,
+// from the most to the least recently touched
+type bucket struct {
+	frequency uint64
+	nodes     *list.List
+	// position within the list of buckets
+	el *list.Element
+}
+
+type node struct {
+	entry     engines.Entry
+	frequency uint64
+	// whether the node lives in the privileged partition
+	privileged bool
+	// bucket of the unprivileged node, nil otherwise
+	bucket *bucket
+	// position within its partition, nil while the node is pinned
+	el *list.Element
+}
+
+// lfru is the engines.Engine counterpart of Cache. Recently inserted or hit
+// elements live in a privileged partition handled as an lru, which takes up
+// to half of the capacity. Elements falling off it are demoted to an
+// unprivileged partition handled as an lfu, which is evicted first. A hit on
+// an unprivileged element promotes it back
+type lfru struct {
+	capacity engines.Capacity
+	// bounds of the privileged partition
+	share engines.Capacity
+	size  uint64
+	nodes map[string]*node
+	// privileged partition, most recently touched first
+	privileged     *list.List
+	privilegedSize uint64
+	// unprivileged partition, buckets sorted by ascending frequency, none of
+	// them empty
+	buckets   *list.List
+	pins      engines.Pins
+	onEvicted engines.EvictionFn
+}
+
+// New initializes a new cache by providing the maximum capacity in bytes
+// which, once reached, will provoke to evict the lfu unprivileged element
+func New(capacity uint64) *lfru {
+	return NewBounded(engines.Capacity{Bytes: capacity})
+}
+
+// NewBounded initializes a new cache bounded by bytes, entries or both
+func NewBounded(capacity engines.Capacity) *lfru {
+	return &lfru{
+		capacity: capacity,
+		share: engines.Capacity{
+			Bytes:   half(capacity.Bytes),
+			Entries: half(capacity.Entries),
+		},
+		nodes:      make(map[string]*node),
+		privileged: list.New(),
+		buckets:    list.New(),
+	}
+}
+
+// half rounds up, so that bounded partitions are never left unbounded
+func half(bound uint64) uint64 {
+	return (bound + 1) / 2
+}
+
+func (c *lfru) OnEvict(onEvicted engines.EvictionFn) {
+	c.onEvicted = onEvicted
+}
+
+// promote puts the node at the front of the privileged partition
+func (c *lfru) promote(n *node) {
+	n.privileged = true
+	n.el = c.privileged.PushFront(n)
+	c.privilegedSize += n.entry.Len()
+}
+
+// place puts the node into the unprivileged bucket of its frequency
+func (c *lfru) place(n *node) {
+	el := c.buckets.Front()
+	for el != nil && el.Value.(*bucket).frequency < n.frequency {
+		el = el.Next()
+	}
+	var b *bucket
+	switch {
+	case el != nil && el.Value.(*bucket).frequency == n.frequency:
+		b = el.Value.(*bucket)
+	case el != nil:
+		b = &bucket{frequency: n.frequency, nodes: list.New()}
+		b.el = c.buckets.InsertBefore(b, el)
+	default:
+		b = &bucket{frequency: n.frequency, nodes: list.New()}
+		b.el = c.buckets.PushBack(b)
+	}
+	n.privileged = false
+	n.bucket = b
+	n.el = b.nodes.PushFront(n)
+}
+
+// unplace takes the node out of its partition
+func (c *lfru) unplace(n *node) {
+	if n.privileged {
+		c.privileged.Remove(n.el)
+		c.privilegedSize -= n.entry.Len()
+	} else {
+		b := n.bucket
+		b.nodes.Remove(n.el)
+		if b.nodes.Len() < 1 {
+			c.buckets.Remove(b.el)
+		}
+	}
+	n.bucket, n.el = nil, nil
+}
+
+// demote moves the least recently touched privileged elements to the
+// unprivileged partition until the privileged one fits in its share
+func (c *lfru) demote() {
+	for c.share.Exceeded(c.privilegedSize, uint64(c.privileged.Len())) {
+		el := c.privileged.Back()
+		if el == nil {
+			return
+		}
+		n := el.Value.(*node)
+		c.unplace(n)
+		c.place(n)
+	}
+}
+
+// evict drops the lfu unprivileged element which is not pinned or, if there
+// is none, the lru privileged one. Returns whether there was any
+func (c *lfru) evict() bool {
+	var n *node
+	if first := c.buckets.Front(); first != nil {
+		n = first.Value.(*bucket).nodes.Back().Value.(*node)
+	} else if last := c.privileged.Back(); last != nil {
+		n = last.Value.(*node)
+	} else {
+		return false
+	}
+	c.unplace(n)
+	delete(c.nodes, n.entry.Key())
+	c.size -= n.entry.Len()
+	if c.onEvicted != nil {
+		c.onEvicted(n.entry)
+	}
+	return true
+}
+
+// Insert puts a key-value pair into the cache. Returns whether the pair
+// was inserted. `false` means that the element was cached already or that
+// it is larger than the capacity, in which case nothing is evicted
+func (c *lfru) Insert(key string, value engines.Value) bool {
+	if _, ok := c.nodes[key]; ok {
+		return false
+	}
+	n := &node{entry: engines.NewEntry(key, value), frequency: 1}
+	if !c.capacity.Fits(n.entry.Len()) {
+		return false
+	}
+	c.promote(n)
+	c.nodes[key] = n
+	c.size += n.entry.Len()
+	if engines.PinOnInsert(value) {
+		c.Pin(key)
+	}
+	c.demote()
+	// Pinned elements may keep the capacity exceeded
+	for c.capacity.Exceeded(c.size, uint64(len(c.nodes))) && c.evict() {
+	}
+	return true
+}
+
+// Access returns an element by key if it is within the cache already,
+// raising its frequency and promoting it to the privileged partition
+func (c *lfru) Access(key string) (engines.Value, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return nil, false
+	}
+	n.frequency++
+	switch {
+	case n.el == nil:
+	case n.privileged:
+		c.privileged.MoveToFront(n.el)
+	default:
+		c.unplace(n)
+		c.promote(n)
+		c.demote()
+	}
+	n.entry.Touch()
+	return n.entry.Value(), true
+}
+
+// Peek returns an element by key, if cached, leaving its frequency and
+// partition as they are
+func (c *lfru) Peek(key string) (engines.Value, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return nil, false
+	}
+	return n.entry.Value(), true
+}
+
+// Inspect describes an element by key, if cached, leaving its frequency and
+// partition as they are
+func (c *lfru) Inspect(key string) (engines.Info, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return engines.Info{}, false
+	}
+	info := n.entry.Info()
+	info.Pinned = c.pins.Has(key)
+	return info, true
+}
+
+// Remove deletes an element by key. Returns whether the element was
+// in the cache. The eviction hook is not called for explicit removals
+func (c *lfru) Remove(key string) bool {
+	n, ok := c.nodes[key]
+	if !ok {
+		return false
+	}
+	if n.el != nil {
+		c.unplace(n)
+	}
+	delete(c.nodes, key)
+	c.size -= n.entry.Len()
+	c.pins.Remove(key)
+	return true
+}
+
+// Evict drops the element which would go next were room needed. Returns
+// whether there was any
+func (c *lfru) Evict() bool {
+	return c.evict()
+}
+
+// Pin exempts an element from eviction by taking it out of its partition.
+// Returns whether the element is in the cache
+func (c *lfru) Pin(key string) bool {
+	n, ok := c.nodes[key]
+	if !ok {
+		return false
+	}
+	if n.el != nil {
+		c.unplace(n)
+	}
+	c.pins.Add(key, n.entry.Len())
+	return true
+}
+
+// Unpin puts an element back into the unprivileged bucket of its
+// frequency. Returns whether it was pinned
+func (c *lfru) Unpin(key string) bool {
+	if !c.pins.Remove(key) {
+		return false
+	}
+	c.place(c.nodes[key])
+	return true
+}
+
+// Pinned returns how many bytes pinned elements take
+func (c *lfru) Pinned() uint64 {
+	return c.pins.Size()
+}
+
+// Size returns the current length of the cache
+func (c *lfru) Size() uint64 {
+	return c.size
+}
+
+// Dump returns the current state of the cache: pinned elements first, then
+// privileged ones from the most recently touched and then unprivileged ones
+// down to the next to be evicted
+func (c *lfru) Dump() []engines.Entry {
+	result := make([]engines.Entry, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		if n.el == nil {
+			result = append(result, n.entry)
+		}
+	}
+	for el := c.privileged.Front(); el != nil; el = el.Next() {
+		result = append(result, el.Value.(*node).entry)
+	}
+	for el := c.buckets.Back(); el != nil; el = el.Prev() {
+		for nel := el.Value.(*bucket).nodes.Front(); nel != nil; nel = nel.Next() {
+			result = append(result, nel.Value.(*node).entry)
+		}
+	}
+	return result
+}
+
+// Scan returns up to count entries whose keys match pattern, following
+// cursor, along with the cursor of the next page. See engines.Page
+func (c *lfru) Scan(cursor string, count int, pattern string) ([]engines.Entry, string) {
+	page := engines.NewPage(cursor, count, pattern)
+	for _, n := range c.nodes {
+		page.Offer(n.entry)
+	}
+	return page.Entries()
+}
@@ -0,0 +1,112 @@
+package engines
+
+import (
+	"github.com/sonirico/mecachis/engines"
+	"reflect"
+	"testing"
+)
+
+type cachevalue string
+
+func (v cachevalue) Value() interface{} {
+	return v
+}
+
+func (v cachevalue) Len() uint64 {
+	return uint64(len(v))
+}
+
+func keys(entries []engines.Entry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Key()
+	}
+	return result
+}
+
+func TestEngineLFRU_EvictsUnprivileged_Insert(t *testing.T) {
+	evicted := make([]string, 0)
+	// Two entries are privileged
+	cache := NewBounded(engines.Capacity{Entries: 4})
+	cache.OnEvict(func(entry engines.Entry) {
+		evicted = append(evicted, entry.Key())
+	})
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		cache.Insert(key, cachevalue(key))
+	}
+	if !reflect.DeepEqual(evicted, []string{"a"}) {
+		t.Errorf("wrong set of elements have been evicted. want [a], have %v", evicted)
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"e", "d", "c", "b"}) {
+		t.Errorf("unexpected cache state. want [e d c b], have %v", have)
+	}
+}
+
+func TestEngineLFRU_Access_Promotes(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Entries: 4})
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.Insert(key, cachevalue(key))
+	}
+	// "b" goes back to the privileged partition, demoting "c"
+	cache.Access("b")
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"b", "d", "c", "a"}) {
+		t.Errorf("unexpected cache state. want [b d c a], have %v", have)
+	}
+	// Once demoted again, "b" outlives the ones hit less
+	cache.Insert("e", cachevalue("e"))
+	cache.Insert("f", cachevalue("f"))
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"f", "e", "b", "d"}) {
+		t.Errorf("unexpected cache state. want [f e b d], have %v", have)
+	}
+}
+
+func TestEngineLFRU_Peek_KeepsPartition(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Entries: 2})
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	if value, ok := cache.Peek("a"); !ok || value != cachevalue("1") {
+		t.Errorf("unexpected peek result. want 1, have %v", value)
+	}
+	cache.Insert("c", cachevalue("3"))
+	if _, ok := cache.Peek("a"); ok {
+		t.Errorf("unexpected cache result. expected peeked 'a' to be evicted")
+	}
+}
+
+func TestEngineLFRU_Pin(t *testing.T) {
+	cache := New(8)
+	cache.Insert("a", cachevalue("1"))
+	cache.Pin("a")
+	for _, key := range []string{"b", "c", "d", "e"} {
+		cache.Insert(key, cachevalue(key))
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"a", "e", "d", "c"}) {
+		t.Errorf("unexpected cache state. want [a e d c], have %v", have)
+	}
+	cache.Unpin("a")
+	cache.Insert("f", cachevalue("f"))
+	if _, ok := cache.Peek("c"); ok {
+		t.Errorf("unexpected cache result. expected 'c' to be evicted before unpinned 'a'")
+	}
+	if _, ok := cache.Peek("a"); !ok {
+		t.Errorf("unexpected cache result. expected unpinned 'a' to be kept")
+	}
+}
+
+func TestEngineLFRU_Remove(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Entries: 2})
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Insert("c", cachevalue("3"))
+	for _, key := range []string{"b", "c"} {
+		if !cache.Remove(key) {
+			t.Errorf("unexpected remove result for '%s'. want true, have false", key)
+		}
+	}
+	if cache.Remove("a") {
+		t.Errorf("unexpected remove result. want false, have true")
+	}
+	if cache.Size() != 0 || len(cache.Dump()) != 0 {
+		t.Errorf("unexpected cache state. want empty, have %v", keys(cache.Dump()))
+	}
+}
@@ -9,6 +9,9 @@ type cacheKey interface{}
 type cacheValue interface{}
 
 // Cache represents the LFU cache
+//
+// Deprecated: use New or NewBounded, whose engines implement
+// engines.Engine and are what hubs and typed caches run on
 type Cache struct {
 	// Maximum capacity
 	Capacity uint
@@ -23,6 +26,8 @@ type Cache struct {
 // NewCache initializes a new Cache by providing the maximum
 // capacity which, once reached, will provoke to evict the LRU
 // element
+//
+// Deprecated: use New or NewBounded instead
 func NewCache(capacity uint) *Cache {
 	cache := &Cache{
 		Capacity:     capacity,
@@ -99,6 +104,16 @@ func (c *Cache) FreqKey(key interface{}) (uint, error) {
 	return node.parent.value, nil
 }
 
+// Peek returns the cached value for a key if exists, leaving its
+// frequency as it is. Otherwise, return an error
+func (c *Cache) Peek(key interface{}) (interface{}, error) {
+	node, ok := c.items[key]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("element %v is not cached", key))
+	}
+	return node.value, nil
+}
+
 // Access returns the cached value for a key if exists. Otherwise,
 // return an error
 func (c *Cache) Access(key interface{}) (interface{}, error) {
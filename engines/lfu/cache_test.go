@@ -144,3 +144,17 @@ func TestCache_Access(t *testing.T) {
 
 	testCacheFrequencyEqualsMaybe(t, cache, 4, expectedFreqs, maybeNode)
 }
+
+func TestCache_Peek(t *testing.T) {
+	cache := newCache(2, []testNode{{"a", 1}})
+	value, err := cache.Peek("a")
+	if err != nil || value != 1 {
+		t.Errorf("unexpected value. want 1, have %v (%v)", value, err)
+	}
+	if freq, _ := cache.FreqKey("a"); freq != 1 {
+		t.Errorf("unexpected frequency. want 1, have %d", freq)
+	}
+	if _, err := cache.Peek("b"); err == nil {
+		t.Errorf("expected error for a missing element")
+	}
+}
@@ -0,0 +1,260 @@
+package engines
+
+import (
+	"container/list"
+	"github.com/sonirico/mecachis/engines"
+)
+
+// bucket holds the nodes accessed the same number of times, from the most
+// to the least recently touched
+type bucket struct {
+	frequency uint64
+	nodes     *list.List
+	// position within the list of buckets
+	el *list.Element
+}
+
+type node struct {
+	entry     engines.Entry
+	frequency uint64
+	// bucket and position within it, both nil while the node is pinned
+	bucket *bucket
+	el     *list.Element
+}
+
+// lfu is the engines.Engine counterpart of Cache. Keys are strings and
+// ties among the least frequently used elements are broken by evicting the
+// least recently used one. Every operation takes constant time
+type lfu struct {
+	capacity engines.Capacity
+	size     uint64
+	nodes    map[string]*node
+	// buckets sorted by ascending frequency, none of them empty
+	buckets   *list.List
+	pins      engines.Pins
+	onEvicted engines.EvictionFn
+}
+
+// New initializes a new cache by providing the maximum capacity in bytes
+// which, once reached, will provoke to evict the lfu element
+func New(capacity uint64) *lfu {
+	return NewBounded(engines.Capacity{Bytes: capacity})
+}
+
+// NewBounded initializes a new cache bounded by bytes, entries or both
+func NewBounded(capacity engines.Capacity) *lfu {
+	return &lfu{
+		capacity: capacity,
+		nodes:    make(map[string]*node),
+		buckets:  list.New(),
+	}
+}
+
+func (c *lfu) OnEvict(onEvicted engines.EvictionFn) {
+	c.onEvicted = onEvicted
+}
+
+// place puts the node into the bucket of its frequency, which is looked up
+// from the bucket at hint, if any, onwards
+func (c *lfu) place(n *node, hint *list.Element) {
+	el := hint
+	if el == nil {
+		el = c.buckets.Front()
+	}
+	for el != nil && el.Value.(*bucket).frequency < n.frequency {
+		el = el.Next()
+	}
+	var b *bucket
+	switch {
+	case el != nil && el.Value.(*bucket).frequency == n.frequency:
+		b = el.Value.(*bucket)
+	case el != nil:
+		b = &bucket{frequency: n.frequency, nodes: list.New()}
+		b.el = c.buckets.InsertBefore(b, el)
+	default:
+		b = &bucket{frequency: n.frequency, nodes: list.New()}
+		b.el = c.buckets.PushBack(b)
+	}
+	n.bucket = b
+	n.el = b.nodes.PushFront(n)
+}
+
+// unplace takes the node out of its bucket
+func (c *lfu) unplace(n *node) {
+	c.drop(n.bucket, n.el)
+	n.bucket, n.el = nil, nil
+}
+
+// drop removes the element from the bucket, and the bucket itself once
+// it is empty
+func (c *lfu) drop(b *bucket, el *list.Element) {
+	b.nodes.Remove(el)
+	if b.nodes.Len() < 1 {
+		c.buckets.Remove(b.el)
+	}
+}
+
+// evict drops the lfu element which is not pinned. Returns whether there
+// was any
+func (c *lfu) evict() bool {
+	first := c.buckets.Front()
+	if first == nil {
+		return false
+	}
+	n := first.Value.(*bucket).nodes.Back().Value.(*node)
+	c.unplace(n)
+	delete(c.nodes, n.entry.Key())
+	c.size -= n.entry.Len()
+	if c.onEvicted != nil {
+		c.onEvicted(n.entry)
+	}
+	return true
+}
+
+// Insert puts a key-value pair into the cache. Returns whether the pair
+// was inserted. `false` means that the element was cached already or that
+// it is larger than the capacity, in which case nothing is evicted
+func (c *lfu) Insert(key string, value engines.Value) bool {
+	if _, ok := c.nodes[key]; ok {
+		return false
+	}
+	n := &node{entry: engines.NewEntry(key, value), frequency: 1}
+	if !c.capacity.Fits(n.entry.Len()) {
+		return false
+	}
+	// Room is made beforehand, as the new element would be the lfu one
+	for c.capacity.Exceeded(c.size+n.entry.Len(), uint64(len(c.nodes))+1) && c.evict() {
+	}
+	c.place(n, nil)
+	c.nodes[key] = n
+	c.size += n.entry.Len()
+	if engines.PinOnInsert(value) {
+		c.Pin(key)
+	}
+	// Elements larger than the room left by pinned ones go away
+	for c.capacity.Exceeded(c.size, uint64(len(c.nodes))) && c.evict() {
+	}
+	return true
+}
+
+// Access returns an element by key if it is within the cache already,
+// raising its frequency
+func (c *lfu) Access(key string) (engines.Value, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return nil, false
+	}
+	n.frequency++
+	if b, el := n.bucket, n.el; b != nil {
+		// The next bucket is looked up from the current one, which is left
+		// afterwards as it may go away
+		c.place(n, b.el)
+		c.drop(b, el)
+	}
+	n.entry.Touch()
+	return n.entry.Value(), true
+}
+
+// Peek returns an element by key, if cached, leaving its frequency as it is
+func (c *lfu) Peek(key string) (engines.Value, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return nil, false
+	}
+	return n.entry.Value(), true
+}
+
+// Inspect describes an element by key, if cached, leaving its frequency as
+// it is
+func (c *lfu) Inspect(key string) (engines.Info, bool) {
+	n, ok := c.nodes[key]
+	if !ok {
+		return engines.Info{}, false
+	}
+	info := n.entry.Info()
+	info.Pinned = c.pins.Has(key)
+	return info, true
+}
+
+// Remove deletes an element by key. Returns whether the element was
+// in the cache. The eviction hook is not called for explicit removals
+func (c *lfu) Remove(key string) bool {
+	n, ok := c.nodes[key]
+	if !ok {
+		return false
+	}
+	if n.bucket != nil {
+		c.unplace(n)
+	}
+	delete(c.nodes, key)
+	c.size -= n.entry.Len()
+	c.pins.Remove(key)
+	return true
+}
+
+// Evict drops the lfu element which is not pinned, as if room was needed.
+// Returns whether there was any
+func (c *lfu) Evict() bool {
+	return c.evict()
+}
+
+// Pin exempts an element from eviction by taking it out of its bucket.
+// Returns whether the element is in the cache
+func (c *lfu) Pin(key string) bool {
+	n, ok := c.nodes[key]
+	if !ok {
+		return false
+	}
+	if n.bucket != nil {
+		c.unplace(n)
+	}
+	c.pins.Add(key, n.entry.Len())
+	return true
+}
+
+// Unpin puts an element back into the bucket of its frequency. Returns
+// whether it was pinned
+func (c *lfu) Unpin(key string) bool {
+	if !c.pins.Remove(key) {
+		return false
+	}
+	c.place(c.nodes[key], nil)
+	return true
+}
+
+// Pinned returns how many bytes pinned elements take
+func (c *lfu) Pinned() uint64 {
+	return c.pins.Size()
+}
+
+// Size returns the current length of the cache
+func (c *lfu) Size() uint64 {
+	return c.size
+}
+
+// Dump returns the current state of the cache, from the most frequently
+// used element to the next to be evicted. Pinned elements come first
+func (c *lfu) Dump() []engines.Entry {
+	result := make([]engines.Entry, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		if n.bucket == nil {
+			result = append(result, n.entry)
+		}
+	}
+	for el := c.buckets.Back(); el != nil; el = el.Prev() {
+		for nel := el.Value.(*bucket).nodes.Front(); nel != nil; nel = nel.Next() {
+			result = append(result, nel.Value.(*node).entry)
+		}
+	}
+	return result
+}
+
+// Scan returns up to count entries whose keys match pattern, following
+// cursor, along with the cursor of the next page. See engines.Page
+func (c *lfu) Scan(cursor string, count int, pattern string) ([]engines.Entry, string) {
+	page := engines.NewPage(cursor, count, pattern)
+	for _, n := range c.nodes {
+		page.Offer(n.entry)
+	}
+	return page.Entries()
+}
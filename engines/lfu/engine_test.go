@@ -0,0 +1,116 @@
+package engines
+
+import (
+	"github.com/sonirico/mecachis/engines"
+	"reflect"
+	"testing"
+)
+
+type cachevalue string
+
+func (v cachevalue) Value() interface{} {
+	return v
+}
+
+func (v cachevalue) Len() uint64 {
+	return uint64(len(v))
+}
+
+func keys(entries []engines.Entry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Key()
+	}
+	return result
+}
+
+func TestEngineLFU_EvictsLFU_Insert(t *testing.T) {
+	evicted := make([]string, 0)
+	cache := New(6)
+	cache.OnEvict(func(entry engines.Entry) {
+		evicted = append(evicted, entry.Key())
+	})
+	cache.Insert("a", cachevalue("1")) // +2
+	cache.Insert("b", cachevalue("2")) // +2
+	cache.Insert("c", cachevalue("3")) // +2
+	cache.Access("a")
+	cache.Access("a")
+	cache.Access("b")
+	cache.Insert("d", cachevalue("4")) // +2, evicts "c"
+	cache.Insert("e", cachevalue("5")) // +2, evicts "d"
+	if !reflect.DeepEqual(evicted, []string{"c", "d"}) {
+		t.Errorf("wrong set of elements have been evicted. want [c d], have %v", evicted)
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"a", "b", "e"}) {
+		t.Errorf("unexpected cache state. want [a b e], have %v", have)
+	}
+	if cache.Size() != 6 {
+		t.Errorf("wrong cache size. want %d. have %d", 6, cache.Size())
+	}
+}
+
+func TestEngineLFU_BreaksTiesByRecency_Insert(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Entries: 2})
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Access("a")
+	cache.Access("b")
+	cache.Insert("c", cachevalue("3")) // evicts "a", touched before "b"
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"b", "c"}) {
+		t.Errorf("unexpected cache state. want [b c], have %v", have)
+	}
+}
+
+func TestEngineLFU_Peek_KeepsFrequency(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Entries: 2})
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Access("b")
+	if value, ok := cache.Peek("a"); !ok || value != cachevalue("1") {
+		t.Errorf("unexpected peek result. want 1, have %v", value)
+	}
+	cache.Insert("c", cachevalue("3"))
+	if _, ok := cache.Peek("a"); ok {
+		t.Errorf("unexpected cache result. expected peeked 'a' to be evicted")
+	}
+}
+
+func TestEngineLFU_Pin(t *testing.T) {
+	cache := New(6)
+	cache.Insert("a", cachevalue("1"))
+	cache.Pin("a")
+	cache.Insert("b", cachevalue("2"))
+	cache.Access("b")
+	cache.Insert("c", cachevalue("3"))
+	cache.Insert("d", cachevalue("4")) // evicts "c", "a" being pinned
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"a", "b", "d"}) {
+		t.Errorf("unexpected cache state. want [a b d], have %v", have)
+	}
+	if info, _ := cache.Inspect("a"); !info.Pinned || cache.Pinned() != 2 {
+		t.Errorf("unexpected pins. want 'a' pinned taking 2 bytes, have %v and %d", info.Pinned, cache.Pinned())
+	}
+	cache.Unpin("a")
+	cache.Insert("e", cachevalue("5")) // evicts "d", as "a" is back as touched
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"b", "e", "a"}) {
+		t.Errorf("unexpected cache state. want [b e a], have %v", have)
+	}
+}
+
+func TestEngineLFU_Remove(t *testing.T) {
+	cache := New(0)
+	cache.Insert("a", cachevalue("1"))
+	cache.Insert("b", cachevalue("2"))
+	cache.Access("a")
+	if !cache.Remove("a") {
+		t.Errorf("unexpected remove result. want true, have false")
+	}
+	if cache.Remove("a") {
+		t.Errorf("unexpected remove result. want false, have true")
+	}
+	if have := keys(cache.Dump()); !reflect.DeepEqual(have, []string{"b"}) {
+		t.Errorf("unexpected cache state. want [b], have %v", have)
+	}
+	if cache.Size() != 2 {
+		t.Errorf("wrong cache size. want %d. have %d", 2, cache.Size())
+	}
+}
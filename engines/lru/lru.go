@@ -7,11 +7,12 @@ import (
 
 // cache represents the lru cache
 type lru struct {
-	// how much capacity in bytes
-	capacity  uint64
+	// how many bytes and entries fit in
+	capacity  engines.Capacity
 	size      uint64
 	list      *list.List
 	cache     map[string]*list.Element
+	pins      engines.Pins
 	onEvicted engines.EvictionFn
 }
 
@@ -19,6 +20,11 @@ type lru struct {
 // capacity which, once reached, will provoke to evict the lru
 // element
 func New(capacity uint64) *lru {
+	return NewBounded(engines.Capacity{Bytes: capacity})
+}
+
+// NewBounded initializes a new cache bounded by bytes, entries or both
+func NewBounded(capacity engines.Capacity) *lru {
 	return &lru{
 		capacity: capacity,
 		size:     0,
@@ -31,10 +37,15 @@ func (c *lru) OnEvict(onEvicted engines.EvictionFn) {
 	c.onEvicted = onEvicted
 }
 
-func (c *lru) evict() {
+// evict drops the lru element which is not pinned. Returns whether there
+// was any
+func (c *lru) evict() bool {
 	el := c.list.Back()
+	for el != nil && c.pins.Has(el.Value.(engines.Entry).Key()) {
+		el = el.Prev()
+	}
 	if el == nil {
-		return
+		return false
 	}
 	c.list.Remove(el)
 	entry := el.Value.(engines.Entry)
@@ -43,25 +54,29 @@ func (c *lru) evict() {
 	if c.onEvicted != nil {
 		c.onEvicted(entry)
 	}
-	return
+	return true
 }
 
 // Insert puts a key-value pair into the cache. Returns whether the pair
-// was inserted. `false` means that the element was cached already
+// was inserted. `false` means that the element was cached already or that
+// it is larger than the capacity, in which case nothing is evicted
 func (c *lru) Insert(key string, value engines.Value) bool {
 	if el, ok := c.cache[key]; ok {
 		c.list.MoveToFront(el)
 		return false
 	}
 	entry := engines.NewEntry(key, value)
+	if !c.capacity.Fits(entry.Len()) {
+		return false
+	}
 	el := c.list.PushFront(entry)
 	c.cache[key] = el
 	c.size += entry.Len()
-	if c.capacity > 0 {
-		// Limit configured
-		for c.size > c.capacity {
-			c.evict()
-		}
+	if engines.PinOnInsert(value) {
+		c.pins.Add(key, entry.Len())
+	}
+	// Pinned elements may keep the capacity exceeded
+	for c.capacity.Exceeded(c.size, uint64(len(c.cache))) && c.evict() {
 	}
 	return true
 }
@@ -75,9 +90,73 @@ func (c *lru) Access(key string) (engines.Value, bool) {
 	}
 	c.list.MoveToFront(el)
 	entry := el.Value.(engines.Entry)
+	entry.Touch()
 	return entry.Value(), true
 }
 
+// Peek returns an element by key, if cached, leaving its recency as it is
+func (c *lru) Peek(key string) (engines.Value, bool) {
+	el, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(engines.Entry).Value(), true
+}
+
+// Inspect describes an element by key, if cached, leaving its recency as
+// it is
+func (c *lru) Inspect(key string) (engines.Info, bool) {
+	el, ok := c.cache[key]
+	if !ok {
+		return engines.Info{}, false
+	}
+	info := el.Value.(engines.Entry).Info()
+	info.Pinned = c.pins.Has(key)
+	return info, true
+}
+
+// Remove deletes an element by key. Returns whether the element was
+// in the cache. The eviction hook is not called for explicit removals
+func (c *lru) Remove(key string) bool {
+	el, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.list.Remove(el)
+	entry := el.Value.(engines.Entry)
+	delete(c.cache, key)
+	c.size -= entry.Len()
+	c.pins.Remove(key)
+	return true
+}
+
+// Evict drops the lru element which is not pinned, as if room was needed.
+// Returns whether there was any
+func (c *lru) Evict() bool {
+	return c.evict()
+}
+
+// Pin exempts an element from eviction. Returns whether the element is in
+// the cache
+func (c *lru) Pin(key string) bool {
+	el, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.pins.Add(key, el.Value.(engines.Entry).Len())
+	return true
+}
+
+// Unpin makes an element evictable again. Returns whether it was pinned
+func (c *lru) Unpin(key string) bool {
+	return c.pins.Remove(key)
+}
+
+// Pinned returns how many bytes pinned elements take
+func (c *lru) Pinned() uint64 {
+	return c.pins.Size()
+}
+
 // Size returns the current length of the cache
 func (c *lru) Size() uint64 {
 	return c.size
@@ -95,11 +174,22 @@ func (c *lru) Dump() []engines.Entry {
 	return result
 }
 
+// Scan returns up to count entries whose keys match pattern, following
+// cursor, along with the cursor of the next page. See engines.Page
+func (c *lru) Scan(cursor string, count int, pattern string) ([]engines.Entry, string) {
+	page := engines.NewPage(cursor, count, pattern)
+	for _, el := range c.cache {
+		page.Offer(el.Value.(engines.Entry))
+	}
+	return page.Entries()
+}
+
 // Free empties the cache, leaving it with the initial state
 func (c *lru) Free() {
 	for k, _ := range c.cache {
 		delete(c.cache, k)
 	}
 	c.list.Init()
+	c.pins = engines.Pins{}
 	c.size = 0
 }
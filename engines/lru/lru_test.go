@@ -1,6 +1,7 @@
 package engines
 
 import (
+	"fmt"
 	"github.com/sonirico/mecachis/engines"
 	"reflect"
 	"testing"
@@ -93,6 +94,34 @@ func TestCacheLRU_EvictsLRUIfExceedingCapacity_Insert(t *testing.T) {
 	testCacheStateEquals(t, cache, expectedState)
 }
 
+func TestCacheLRU_EvictsLRUIfExceedingEntries_Insert(t *testing.T) {
+	cache := NewBounded(engines.Capacity{Bytes: 64, Entries: 2})
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Insert(key, cachevalue("1"))
+	}
+	expectedState := &expectedState{
+		Nodes: []testNode{
+			{"c", cachevalue("1")},
+			{"b", cachevalue("1")},
+		},
+		CacheSize: 4,
+	}
+	testCacheStateEquals(t, cache, expectedState)
+}
+
+func TestCacheLRU_RejectsOversized_Insert(t *testing.T) {
+	evicted := 0
+	cache := newCache(4, []testNode{{"a", cachevalue("1")}})
+	cache.OnEvict(func(engines.Entry) { evicted++ })
+	if cache.Insert("b", cachevalue("1234")) {
+		t.Errorf("unexpected insert result. want false, have true")
+	}
+	if evicted != 0 {
+		t.Errorf("unexpected evictions. want 0, have %d", evicted)
+	}
+	testCacheSizeEquals(t, cache, 2)
+}
+
 func TestCacheLRUReturnsErrorIfDuplicated_Insert(t *testing.T) {
 	var payload []testNode
 	cache := newCache(3, payload)
@@ -131,11 +160,11 @@ func TestCacheLRU_Access_UpgradesToHead(t *testing.T) {
 
 func TestCacheLRU_Access_UpgradesToHead_OneElement(t *testing.T) {
 	payload := []testNode{
-		{"a", cachevalue(1)},
+		{"a", cachevalue("1")},
 	}
 	expectedState := &expectedState{
 		Nodes: []testNode{
-			{"a", cachevalue(1)},
+			{"a", cachevalue("1")},
 		},
 		CacheSize: 2,
 	}
@@ -144,9 +173,81 @@ func TestCacheLRU_Access_UpgradesToHead_OneElement(t *testing.T) {
 	testCacheStateEquals(t, cache, expectedState)
 }
 
+func TestCacheLRU_Peek_KeepsRecency(t *testing.T) {
+	payload := []testNode{
+		{"a", cachevalue("1")}, // +2
+		{"b", cachevalue("2")}, // +2
+	}
+	cache := newCache(4, payload)
+	value, ok := cache.Peek("a")
+	if !ok || value.(cachevalue) != "1" {
+		t.Errorf("wrong cachevalue returned. want '%s', have '%v'", "1", value)
+	}
+	cache.Insert("c", cachevalue("3")) // "a" is still the lru element
+	if _, ok := cache.Peek("a"); ok {
+		t.Errorf("expected peeked element to be evicted")
+	}
+}
+
+func TestCacheLRU_Inspect(t *testing.T) {
+	cache := newCache(0, []testNode{{"a", cachevalue("1")}})
+	info, _ := cache.Inspect("a")
+	if info.Accesses != 0 || !info.Accessed.IsZero() || info.Size != 2 {
+		t.Errorf("unexpected info. want 2 bytes never accessed, have %+v", info)
+	}
+	cache.Access("a")
+	cache.Access("a")
+	cache.Peek("a")
+	info, _ = cache.Inspect("a")
+	if info.Accesses != 2 || info.Accessed.Before(info.Inserted) {
+		t.Errorf("unexpected info. want 2 accesses after insertion, have %+v", info)
+	}
+	if _, ok := cache.Inspect("b"); ok {
+		t.Errorf("expected missing element not to be inspected")
+	}
+}
+
+func TestCacheLRU_Pin_SkipsEviction(t *testing.T) {
+	payload := []testNode{
+		{"a", cachevalue("1")}, // +2
+		{"b", cachevalue("2")}, // +2
+	}
+	cache := newCache(4, payload)
+	if !cache.Pin("a") || cache.Pin("z") {
+		t.Fatalf("expected only cached elements to be pinned")
+	}
+	cache.Insert("c", cachevalue("3")) // evicts "b", as "a" is pinned
+	testCacheStateEquals(t, cache, &expectedState{
+		Nodes:     []testNode{{"c", cachevalue("3")}, {"a", cachevalue("1")}},
+		CacheSize: 4,
+	})
+	if cache.Pinned() != 2 {
+		t.Errorf("wrong pinned size. want %d. have %d", 2, cache.Pinned())
+	}
+
+	// Pinned elements are never evicted, even if the capacity is exceeded
+	cache.Pin("c")
+	cache.Insert("d", cachevalue("4"))
+	testCacheStateEquals(t, cache, &expectedState{
+		Nodes:     []testNode{{"c", cachevalue("3")}, {"a", cachevalue("1")}},
+		CacheSize: 4,
+	})
+
+	cache.Unpin("a")
+	cache.Remove("c")
+	cache.Insert("e", cachevalue("55")) // +3, evicts "a"
+	testCacheStateEquals(t, cache, &expectedState{
+		Nodes:     []testNode{{"e", cachevalue("55")}},
+		CacheSize: 3,
+	})
+	if cache.Pinned() != 0 {
+		t.Errorf("wrong pinned size. want %d. have %d", 0, cache.Pinned())
+	}
+}
+
 func TestCacheLRU_OnEvicted(t *testing.T) {
 	payload := []testNode{
-		{"a", cachevalue(1)}, // +2
+		{"a", cachevalue("1")}, // +2
 	}
 	keys := make([]string, 0)
 	onEvicted := func(v engines.Entry) {
@@ -161,3 +262,80 @@ func TestCacheLRU_OnEvicted(t *testing.T) {
 		t.Fatalf("wrong set of elements have been evicted. instead have %v", keys)
 	}
 }
+
+func TestCacheLRU_Remove(t *testing.T) {
+	payload := []testNode{
+		{"a", cachevalue("1")},
+		{"b", cachevalue("2")},
+		{"c", cachevalue("3")},
+	}
+	expectedState := &expectedState{
+		Nodes: []testNode{
+			{"c", cachevalue("3")},
+			{"a", cachevalue("1")},
+		},
+		CacheSize: 4,
+	}
+	cache := newCache(32, payload)
+	if !cache.Remove("b") {
+		t.Errorf("expected successful removal. want %t, have %t", true, false)
+	}
+	if cache.Remove("b") {
+		t.Errorf("expected no removal. want %t, have %t", false, true)
+	}
+	testCacheStateEquals(t, cache, expectedState)
+}
+
+func TestCacheLRU_Scan(t *testing.T) {
+	cache := New(0)
+	for i := 0; i < 50; i++ {
+		cache.Insert(fmt.Sprintf("key-%d", i), cachevalue("v"))
+	}
+	seen := make(map[string]int)
+	cursor, pages := "", 0
+	for {
+		entries, next := cache.Scan(cursor, 7, "key-*")
+		if len(entries) > 7 {
+			t.Fatalf("unexpected page length. want at most 7, have %d", len(entries))
+		}
+		for _, entry := range entries {
+			seen[entry.Key()]++
+		}
+		pages++
+		// Keys inserted or removed meanwhile do not disturb the rest
+		cache.Insert(fmt.Sprintf("new-%d", pages), cachevalue("v"))
+		cache.Remove(fmt.Sprintf("key-%d", 49-pages))
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	for i := 0; i < 50-pages; i++ {
+		if n := seen[fmt.Sprintf("key-%d", i)]; n != 1 {
+			t.Errorf("unexpected times 'key-%d' was scanned. want 1, have %d", i, n)
+		}
+	}
+	for key := range seen {
+		if key[:4] != "key-" {
+			t.Errorf("unexpected key scanned. '%s' does not match the pattern", key)
+		}
+	}
+}
+
+func TestCacheLRU_Evict(t *testing.T) {
+	evicted := make([]string, 0)
+	cache := newCache(0, []testNode{
+		{"a", cachevalue("1")},
+		{"b", cachevalue("2")},
+		{"c", cachevalue("3")},
+	})
+	cache.OnEvict(func(entry engines.Entry) {
+		evicted = append(evicted, entry.Key())
+	})
+	cache.Pin("a")
+	for cache.Evict() {
+	}
+	if !reflect.DeepEqual(evicted, []string{"b", "c"}) {
+		t.Errorf("wrong set of elements have been evicted. want [b c], have %v", evicted)
+	}
+	testCacheSizeEquals(t, cache, 2)
+}
@@ -0,0 +1,42 @@
+package engines
+
+// Pins keeps track of the keys exempt from eviction and of how many bytes
+// they take, which still count toward the capacity of their engine. Not
+// safe for concurrent use
+type Pins struct {
+	keys map[string]uint64
+	size uint64
+}
+
+// Add pins the key, which takes size bytes
+func (p *Pins) Add(key string, size uint64) {
+	if _, ok := p.keys[key]; ok {
+		return
+	}
+	if p.keys == nil {
+		p.keys = make(map[string]uint64)
+	}
+	p.keys[key] = size
+	p.size += size
+}
+
+// Remove unpins the key, returning whether it was pinned
+func (p *Pins) Remove(key string) bool {
+	size, ok := p.keys[key]
+	if !ok {
+		return false
+	}
+	delete(p.keys, key)
+	p.size -= size
+	return true
+}
+
+func (p *Pins) Has(key string) bool {
+	_, ok := p.keys[key]
+	return ok
+}
+
+// Size returns how many bytes pinned keys take
+func (p *Pins) Size() uint64 {
+	return p.size
+}
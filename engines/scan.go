@@ -0,0 +1,109 @@
+package engines
+
+import (
+	"container/heap"
+	"path"
+	"sort"
+)
+
+// Match tells whether key matches the glob pattern, with the syntax of
+// path.Match. Empty patterns match every key, malformed ones none
+func Match(pattern, key string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, key)
+	return err == nil && ok
+}
+
+// ValidPattern tells whether pattern is well formed
+func ValidPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return err != path.ErrBadPattern
+}
+
+type scanned struct {
+	hash  uint32
+	entry Entry
+}
+
+func (s scanned) less(other scanned) bool {
+	if s.hash != other.hash {
+		return s.hash < other.hash
+	}
+	return s.entry.Key() < other.entry.Key()
+}
+
+// scanHeap is a max-heap, so that the entry to drop comes first
+type scanHeap []scanned
+
+func (h scanHeap) Len() int            { return len(h) }
+func (h scanHeap) Less(i, j int) bool  { return h[j].less(h[i]) }
+func (h scanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scanHeap) Push(x interface{}) { *h = append(*h, x.(scanned)) }
+func (h *scanHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Page gathers the entries of a scan, which goes through keys in the order
+// of their hashes, ties broken by the keys themselves. Cursors are the last
+// key of the previous page, so keys cached for the whole scan are returned
+// exactly once whatever is inserted or evicted meanwhile. No more than count
+// entries are kept at a time, however many are offered
+type Page struct {
+	count   int
+	pattern string
+	after   scanned
+	started bool
+	entries scanHeap
+	full    bool
+}
+
+// NewPage starts the page following cursor. Empty cursors start a scan
+func NewPage(cursor string, count int, pattern string) *Page {
+	p := &Page{count: count, pattern: pattern}
+	if cursor != "" {
+		p.started = true
+		p.after = scanned{hash: HashKey(cursor), entry: NewEntry(cursor, nil)}
+	}
+	return p
+}
+
+// Offer adds the entry to the page if it follows the cursor, matches the
+// pattern and precedes the entries gathered so far
+func (p *Page) Offer(entry Entry) {
+	if p.count < 1 || !Match(p.pattern, entry.Key()) {
+		return
+	}
+	candidate := scanned{hash: HashKey(entry.Key()), entry: entry}
+	if p.started && !p.after.less(candidate) {
+		return
+	}
+	if len(p.entries) < p.count {
+		heap.Push(&p.entries, candidate)
+		return
+	}
+	// Entries are left out, hence the scan goes on
+	p.full = true
+	if candidate.less(p.entries[0]) {
+		p.entries[0] = candidate
+		heap.Fix(&p.entries, 0)
+	}
+}
+
+// Entries returns the entries of the page in scan order, along with the
+// cursor of the next page, which is empty once the scan is over
+func (p *Page) Entries() ([]Entry, string) {
+	sort.Slice(p.entries, func(i, j int) bool { return p.entries[i].less(p.entries[j]) })
+	result := make([]Entry, len(p.entries))
+	for i, s := range p.entries {
+		result[i] = s.entry
+	}
+	if !p.full {
+		return result, ""
+	}
+	return result, result[len(result)-1].Key()
+}
@@ -1,6 +1,9 @@
 package mecachis
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/sonirico/mecachis/engines"
+)
 
 type ErrDuplicatedKey struct {
 	key string
@@ -13,3 +16,118 @@ func NewDuplicatedKeyError(key string) *ErrDuplicatedKey {
 func (e *ErrDuplicatedKey) Error() string {
 	return fmt.Sprintf("'%s' is already in the cache", e.key)
 }
+
+type ErrKeyNotFound struct {
+	key string
+}
+
+func NewKeyNotFoundError(key string) *ErrKeyNotFound {
+	return &ErrKeyNotFound{key: key}
+}
+
+func (e *ErrKeyNotFound) Error() string {
+	return fmt.Sprintf("'%s' is not in the cache", e.key)
+}
+
+type ErrDuplicatedGroup struct {
+	ns string
+}
+
+func NewDuplicatedGroupError(ns string) *ErrDuplicatedGroup {
+	return &ErrDuplicatedGroup{ns: ns}
+}
+
+func (e *ErrDuplicatedGroup) Error() string {
+	return fmt.Sprintf("group '%s' already exists", e.ns)
+}
+
+type ErrGroupNotFound struct {
+	ns string
+}
+
+func NewGroupNotFoundError(ns string) *ErrGroupNotFound {
+	return &ErrGroupNotFound{ns: ns}
+}
+
+func (e *ErrGroupNotFound) Error() string {
+	return fmt.Sprintf("group '%s' does not exist", e.ns)
+}
+
+type ErrPreconditionFailed struct {
+	key string
+}
+
+func NewPreconditionFailedError(key string) *ErrPreconditionFailed {
+	return &ErrPreconditionFailed{key: key}
+}
+
+func (e *ErrPreconditionFailed) Error() string {
+	return fmt.Sprintf("precondition failed for '%s'", e.key)
+}
+
+type ErrTooLarge struct {
+	subject string
+	limit   uint64
+}
+
+func NewTooLargeError(subject string, limit uint64) *ErrTooLarge {
+	return &ErrTooLarge{subject: subject, limit: limit}
+}
+
+func (e *ErrTooLarge) Error() string {
+	if e.limit == 0 {
+		// The limit is unknown to clients of the hub
+		return fmt.Sprintf("%s is too large", e.subject)
+	}
+	return fmt.Sprintf("%s exceeds the limit of %d bytes", e.subject, e.limit)
+}
+
+type ErrInvalidPattern struct {
+	pattern string
+}
+
+func NewInvalidPatternError(pattern string) *ErrInvalidPattern {
+	return &ErrInvalidPattern{pattern: pattern}
+}
+
+func (e *ErrInvalidPattern) Error() string {
+	return fmt.Sprintf("invalid pattern '%s'", e.pattern)
+}
+
+type ErrPinLimit struct {
+	key   string
+	limit uint64
+}
+
+func NewPinLimitError(key string, limit uint64) *ErrPinLimit {
+	return &ErrPinLimit{key: key, limit: limit}
+}
+
+func (e *ErrPinLimit) Error() string {
+	return fmt.Sprintf("pinning '%s' exceeds the limit of %d pinned bytes", e.key, e.limit)
+}
+
+type ErrNotAdmitted struct {
+	key    string
+	reason string
+}
+
+func NewNotAdmittedError(key, reason string) *ErrNotAdmitted {
+	return &ErrNotAdmitted{key: key, reason: reason}
+}
+
+func (e *ErrNotAdmitted) Error() string {
+	return fmt.Sprintf("'%s' was not admitted: %s", e.key, e.reason)
+}
+
+type ErrUnsupportedEngine struct {
+	cType engines.CacheType
+}
+
+func NewUnsupportedEngineError(cType engines.CacheType) *ErrUnsupportedEngine {
+	return &ErrUnsupportedEngine{cType: cType}
+}
+
+func (e *ErrUnsupportedEngine) Error() string {
+	return fmt.Sprintf("unsupported engine '%s'", e.cType)
+}
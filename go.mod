@@ -1,3 +1,8 @@
 module github.com/sonirico/mecachis
 
-go 1.14
+go 1.18
+
+require (
+	github.com/golang/snappy v0.0.3
+	github.com/klauspost/compress v1.12.3
+)
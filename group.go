@@ -1,34 +1,294 @@
 package mecachis
 
 import (
+	"github.com/sonirico/mecachis/codec"
 	"github.com/sonirico/mecachis/engines"
+	"github.com/sonirico/mecachis/singlecall"
 	"sync"
+	"time"
 )
 
 type group struct {
 	mx sync.RWMutex
+	GroupConfig
 
-	Ns    string
-	Cap   uint64
-	Ct    engines.CacheType
-	cache *cache
+	Ns         string
+	cache      Cache
+	negative   Cache
+	calls      *singlecall.SingleCall
+	refreshing sync.Map
+	// budget of the hub the group belongs to, if bounded
+	budget *budget
+}
+
+// GroupConfig holds what a group is created with
+type GroupConfig struct {
+	// Cap is the capacity in bytes. Zero means unbounded
+	Cap    uint64
+	Ct     engines.CacheType
+	Shards int
+	Codec  codec.Codec
+	// MaxPinned is the fraction of Cap pinned keys may take. Defaults to
+	// DefaultMaxPinned
+	MaxPinned float64
+	// MaxEntries bounds how many keys the group holds besides Cap. Zero
+	// means unbounded
+	MaxEntries uint64
+	// Weight sets the share of the memory budget of the hub the group is
+	// entitled to, relative to other groups. Defaults to 1
+	Weight float64
+	// Admission are the policies new keys go through, see WithAdmission
+	Admission []Admission
+	// Loader makes the group read-through, see Loader
+	Loader Loader
+	// NegativeTTL is how long keys the loader did not find are remembered
+	// as such. Zero disables negative caching
+	NegativeTTL time.Duration
+	// NegativeCap is the capacity in bytes of the cache of keys not found,
+	// apart from Cap. Defaults to an eighth of Cap, or DefaultNegativeCap
+	// for unbounded groups
+	NegativeCap uint64
+	// TTL is how long loaded values stay fresh. Zero means forever
+	TTL time.Duration
+	// RefreshAhead reloads values in the background when they are hit this
+	// close to going stale
+	RefreshAhead time.Duration
+	// RefreshTimeout bounds background reloads. Defaults to
+	// DefaultRefreshTimeout
+	RefreshTimeout time.Duration
+	// StaleWhileRevalidate serves values up to this long after they went
+	// stale, while they are reloaded in the background
+	StaleWhileRevalidate time.Duration
+	// StaleIfError serves values up to this long after they went stale if
+	// reloading them fails
+	StaleIfError time.Duration
+}
+
+type groupInfo struct {
+	Ns         string  `json:"ns"`
+	Cap        uint64  `json:"cap"`
+	MaxEntries uint64  `json:"max_entries,omitempty"`
+	Weight     float64 `json:"weight,omitempty"`
+	Engine     string  `json:"engine"`
+	Shards     int     `json:"shards"`
+	Codec      string  `json:"codec,omitempty"`
+	Size       uint64  `json:"size"`
 }
 
 func newGroup(name string) *group {
-	g := &group{Ns: name}
+	g := &group{Ns: name, calls: singlecall.New()}
+	g.Shards = 1
 	return g
 }
 
-func (g *group) Add(k string, v MemoryView) error {
+func (g *group) lazyCache() Cache {
+	g.mx.RLock()
+	c := g.cache
+	g.mx.RUnlock()
+	if c != nil {
+		return c
+	}
+	g.mx.Lock()
+	defer g.mx.Unlock()
 	if g.cache == nil {
-		g.cache = NewCache(g.Cap, g.Ct)
+		var opts []CacheOption
+		if g.Codec != nil {
+			opts = append(opts, WithCodec(g.Codec))
+		}
+		if g.MaxPinned > 0 {
+			opts = append(opts, WithMaxPinned(g.MaxPinned))
+		}
+		if g.MaxEntries > 0 {
+			opts = append(opts, WithMaxEntries(g.MaxEntries))
+		}
+		if len(g.Admission) > 0 {
+			opts = append(opts, WithAdmission(g.Admission...))
+		}
+		if g.Shards > 1 {
+			g.cache = NewShardedCache(g.Cap, g.Ct, g.Shards, opts...)
+		} else {
+			g.cache = NewCache(g.Cap, g.Ct, opts...)
+		}
+		if g.NegativeTTL > 0 {
+			negativeCap := g.NegativeCap
+			if negativeCap == 0 {
+				negativeCap = g.Cap / 8
+			}
+			if negativeCap == 0 {
+				negativeCap = DefaultNegativeCap
+			}
+			g.negative = NewCache(negativeCap, engines.LRU)
+		}
+	}
+	return g.cache
+}
+
+// unmark drops the negative marker of a key, which exists once written
+func (g *group) unmark(k string) {
+	if g.negative != nil {
+		_ = g.negative.Remove(k)
+	}
+}
+
+// written accounts a successful write of size bytes under k. Failed writes
+// are not, as they neither create keys nor take room
+func (g *group) written(k string, size uint64) {
+	g.unmark(k)
+	g.budget.grow(size)
+}
+
+func (g *group) Add(k string, v MemoryView) error {
+	err := g.lazyCache().Add(k, v)
+	if err == nil {
+		g.written(k, uint64(len(k))+v.Len())
+	}
+	return err
+}
+
+func (g *group) AddItem(k string, it *Item) error {
+	err := g.lazyCache().AddItem(k, it)
+	if err == nil {
+		g.written(k, uint64(len(k))+it.Len())
 	}
-	return g.cache.Add(k, v)
+	return err
+}
+
+func (g *group) AddMany(kvs []KeyValue) []error {
+	errs := g.lazyCache().AddMany(kvs)
+	var size uint64
+	for i, err := range errs {
+		if err == nil {
+			g.unmark(kvs[i].Key)
+			size += uint64(len(kvs[i].Key)) + kvs[i].Value.Len()
+		}
+	}
+	g.budget.grow(size)
+	return errs
+}
+
+func (g *group) Set(k string, v MemoryView) error {
+	err := g.lazyCache().Set(k, v)
+	if err == nil {
+		g.written(k, uint64(len(k))+v.Len())
+	}
+	return err
+}
+
+func (g *group) SetIf(k string, v MemoryView, cond Condition) error {
+	err := g.lazyCache().SetIf(k, v, cond)
+	if err == nil {
+		g.written(k, uint64(len(k))+v.Len())
+	}
+	return err
+}
+
+func (g *group) SetItem(k string, it *Item, cond Condition) (*Item, error) {
+	stored, err := g.lazyCache().SetItem(k, it, cond)
+	if err == nil {
+		g.written(k, uint64(len(k))+it.Len())
+	}
+	return stored, err
+}
+
+func (g *group) CompareAndSwap(k string, version uint64, v MemoryView) error {
+	err := g.lazyCache().CompareAndSwap(k, version, v)
+	if err == nil {
+		g.written(k, uint64(len(k))+v.Len())
+	}
+	return err
 }
 
 func (g *group) Get(k string) (MemoryView, bool) {
-	if g.cache == nil {
-		g.cache = NewCache(g.Cap, g.Ct)
+	return g.lazyCache().Get(k)
+}
+
+func (g *group) GetMany(ks []string) map[string]MemoryView {
+	return g.lazyCache().GetMany(ks)
+}
+
+func (g *group) Lookup(k string) (*Item, bool) {
+	return g.lazyCache().Lookup(k)
+}
+
+func (g *group) Peek(k string) (*Item, bool) {
+	return g.lazyCache().Peek(k)
+}
+
+func (g *group) Inspect(k string) (KeyInfo, bool) {
+	return g.lazyCache().Inspect(k)
+}
+
+func (g *group) Pin(k string) error {
+	return g.lazyCache().Pin(k)
+}
+
+func (g *group) Unpin(k string) error {
+	return g.lazyCache().Unpin(k)
+}
+
+func (g *group) Remove(k string) error {
+	return g.lazyCache().Remove(k)
+}
+
+func (g *group) RemoveIf(k string, cond Condition) error {
+	return g.lazyCache().RemoveIf(k, cond)
+}
+
+func (g *group) InvalidateTag(tag string) int {
+	return g.lazyCache().InvalidateTag(tag)
+}
+
+func (g *group) InvalidatePrefix(prefix string) int {
+	return g.lazyCache().InvalidatePrefix(prefix)
+}
+
+func (g *group) Scan(cursor string, count int, pattern string) (ScanResult, error) {
+	return g.lazyCache().Scan(cursor, count, pattern)
+}
+
+// size returns the bytes the group takes, without creating its cache. Keys
+// remembered as not found are left out, as NegativeCap bounds them apart
+func (g *group) size() uint64 {
+	g.mx.RLock()
+	c := g.cache
+	g.mx.RUnlock()
+	if c == nil {
+		return 0
+	}
+	return c.Size()
+}
+
+// weight returns the share of the memory budget of the hub the group is
+// entitled to
+func (g *group) weight() float64 {
+	if g.Weight > 0 {
+		return g.Weight
 	}
-	return g.cache.Get(k)
+	return 1
+}
+
+// shrink evicts at least size bytes, unless only pinned entries are left.
+// Returns how many bytes were freed
+func (g *group) shrink(size uint64) uint64 {
+	return g.lazyCache().Shrink(size)
+}
+
+func (g *group) Info() groupInfo {
+	info := groupInfo{
+		Ns:         g.Ns,
+		Cap:        g.Cap,
+		MaxEntries: g.MaxEntries,
+		Weight:     g.Weight,
+		Engine:     g.Ct.String(),
+		Shards:     g.Shards,
+		Size:       g.lazyCache().Size(),
+	}
+	if g.Codec != nil {
+		info.Codec = g.Codec.Name()
+	}
+	return info
+}
+
+func (g *group) Stats() Stats {
+	return g.lazyCache().Stats()
 }
@@ -1,85 +1,556 @@
 package mecachis
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sonirico/mecachis/batch"
+	"github.com/sonirico/mecachis/codec"
 	"github.com/sonirico/mecachis/engines"
-	"io/ioutil"
-	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (h *Hub) handleAdd(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	ns := ctx.Value("ns").(string)
-	key := ctx.Value("key").(string)
-	g, created := h.getOrCreateGroup(ns)
-	if created {
-		// Non-existent group. Check for configuration params
-		g.Cap = readCapacity(r)
-		g.Ct = readEngine(r)
+	ns := nsFromContext(ctx)
+	key := keyFromContext(ctx)
+	content, err := h.readValue(r)
+	if _, ok := err.(*ErrTooLarge); ok {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
 	}
-	content, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Printf(err.Error())
+		h.logger.Log(LevelWarn, "cannot read request body", F("ns", ns), F("key", key), F("error", err))
 		http.Error(w, "error when reading request buffer", http.StatusInternalServerError)
 		return
 	}
-	if err := g.Add(key, content); err != nil {
-		log.Printf(err.Error())
+	g, err := h.groupFromRequest(ns, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if h.canceled(ctx) {
+		return
+	}
+	err = g.AddItem(key, readItem(r, content))
+	if _, ok := err.(*ErrTooLarge); ok {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, ok := err.(*ErrPinLimit); ok {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if _, ok := err.(*ErrNotAdmitted); ok {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		h.logger.Log(LevelDebug, "cannot add key", F("ns", ns), F("key", key), F("error", err))
 		http.Error(w, "error when writing to response buffer", http.StatusConflict)
 		return
 	}
+	w.Header().Set("ETag", etag(content))
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (h *Hub) handleGet(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	ns := ctx.Value("ns").(string)
+func (h *Hub) handleSet(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	key := keyFromContext(ctx)
+	content, err := h.readValue(r)
+	if _, ok := err.(*ErrTooLarge); ok {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		h.logger.Log(LevelWarn, "cannot read request body", F("ns", ns), F("key", key), F("error", err))
+		http.Error(w, "error when reading request buffer", http.StatusInternalServerError)
+		return
+	}
+	g, err := h.groupFromRequest(ns, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if h.canceled(ctx) {
+		return
+	}
+	cond, err := writeCondition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err = g.SetItem(key, readItem(r, content), cond)
+	if _, ok := err.(*ErrPreconditionFailed); ok {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if _, ok := err.(*ErrTooLarge); ok {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, ok := err.(*ErrPinLimit); ok {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if _, ok := err.(*ErrNotAdmitted); ok {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		h.logger.Log(LevelError, "cannot set key", F("ns", ns), F("key", key), F("error", err))
+		http.Error(w, "error when writing to cache", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag(content))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Hub) handleRemove(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
 	g, ok := h.group(ns)
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	key := ctx.Value("key").(string)
-	value, ok := g.Get(key)
+	key := keyFromContext(ctx)
+	cond, err := writeCondition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cond != nil {
+		err = g.RemoveIf(key, cond)
+	} else {
+		err = g.Remove(key)
+	}
+	if _, ok := err.(*ErrPreconditionFailed); ok {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Hub) handleMGet(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	body := newLimitReader(r.Body, h.batchKeysLimit())
+	keys, err := batch.ReadKeys(body)
+	if body.exceeded {
+		err = NewTooLargeError("batch", uint64(h.batchKeysLimit()))
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, key := range keys {
+		if err := validateKey(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if h.canceled(ctx) {
+		return
+	}
+	var values map[string]MemoryView
+	if g, ok := h.group(ns); ok {
+		values = g.GetMany(keys)
+	}
+	results := make([]batch.Result, len(keys))
+	for i, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			results[i] = batch.Result{Status: http.StatusNotFound}
+			continue
+		}
+		results[i] = batch.Result{Status: http.StatusOK, Value: value}
+	}
+	w.Header().Set("Content-Type", batch.ContentType)
+	if err := batch.WriteResults(w, results); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("ns", ns), F("error", err))
+	}
+}
+
+func (h *Hub) handleMSet(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	body := newLimitReader(r.Body, h.batchPairsLimit())
+	pairs, err := batch.ReadPairs(body)
+	if body.exceeded {
+		err = NewTooLargeError("batch", uint64(h.batchPairsLimit()))
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kvs := make([]KeyValue, len(pairs))
+	for i, pair := range pairs {
+		if err := validateKey(pair.Key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kvs[i] = KeyValue{Key: pair.Key, Value: pair.Value}
+	}
+	if err := h.checkValues(kvs); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	g, err := h.groupFromRequest(ns, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if h.canceled(ctx) {
+		return
+	}
+	errs := g.AddMany(kvs)
+	results := make([]batch.Result, len(errs))
+	for i, err := range errs {
+		switch err.(type) {
+		case nil:
+			results[i] = batch.Result{Status: http.StatusCreated}
+		case *ErrTooLarge:
+			results[i] = batch.Result{Status: http.StatusRequestEntityTooLarge}
+		case *ErrNotAdmitted:
+			results[i] = batch.Result{Status: http.StatusInsufficientStorage}
+		default:
+			results[i] = batch.Result{Status: http.StatusConflict}
+		}
+	}
+	w.Header().Set("Content-Type", batch.ContentType)
+	if err := batch.WriteResults(w, results); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("ns", ns), F("error", err))
+	}
+}
+
+// handleInvalidate removes every key of the group cached with the tag or
+// starting with the prefix given, replying how many were
+func (h *Hub) handleInvalidate(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	query := r.URL.Query()
+	tag, prefix := query.Get("tag"), query.Get("prefix")
+	if (tag == "") == (prefix == "") {
+		http.Error(w, "either a tag or a prefix must be given", http.StatusBadRequest)
+		return
+	}
+	g, ok := h.group(ns)
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/octet-stream")
-	if _, err := w.Write(value.Clone()); err != nil {
-		log.Printf(err.Error())
-		http.Error(w, "error when writing to response buffer", http.StatusInternalServerError)
+	var removed int
+	if tag != "" {
+		removed = g.InvalidateTag(tag)
+	} else {
+		removed = g.InvalidatePrefix(prefix)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(invalidation{Invalidated: removed}); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("ns", ns), F("error", err))
 	}
 }
 
-func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	uri := r.URL.Path
-	log.Printf("%s: %s\n", r.Method, uri)
-	if !strings.HasPrefix(uri, basePath) {
+// handleScan lists a page of the keys of the group, along with their sizes
+// and the cursor of the next page
+func (h *Hub) handleScan(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	query := r.URL.Query()
+	count, err := readCount(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	g, ok := h.group(ns)
+	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	uriParts := strings.SplitN(r.URL.Path[len(basePath):], "/", 2)
-	log.Println(uriParts)
-	if len(uriParts) < 2 {
+	result, err := g.Scan(query.Get("cursor"), count, query.Get("match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("ns", ns), F("error", err))
+	}
+}
+
+func (h *Hub) handleCreateGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	if err := h.checkCapacity(r); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, created := h.createGroup(ns, readGroupConfig(r)); !created {
+		http.Error(w, NewDuplicatedGroupError(ns).Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Hub) handleGroupInfo(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	g, ok := h.group(ns)
+	if !ok {
 		http.NotFound(w, r)
 		return
 	}
-	ns := uriParts[0]
-	key := uriParts[1]
-	ctx := context.WithValue(context.Background(), "ns", ns)
-	ctx = context.WithValue(ctx, "key", key)
-	switch r.Method {
-	case http.MethodGet:
-		h.handleGet(ctx, w, r)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(g.Info()); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("ns", ns), F("error", err))
+	}
+}
+
+func (h *Hub) handleRemoveGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	if !h.removeGroup(ns) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Hub) handleStats(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Stats()); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("error", err))
+	}
+}
+
+func (h *Hub) handleGet(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.URL.Query()["meta"]; ok {
+		h.handleInspect(ctx, w, r)
+		return
+	}
+	ns := nsFromContext(ctx)
+	g, ok := h.group(ns)
+	if !ok {
+		http.NotFound(w, r)
 		return
-	case http.MethodPost:
-		h.handleAdd(ctx, w, r)
+	}
+	key := keyFromContext(ctx)
+	var item *Item
+	if g.Loader != nil {
+		var err error
+		item, err = g.load(ctx, key)
+		if isNotFound(err) {
+			w.Header().Set(MissHeader, authoritativeMiss)
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			h.logger.Log(LevelWarn, "cannot load key", F("ns", ns), F("key", key), F("error", err))
+			http.Error(w, "error when loading value", http.StatusBadGateway)
+			return
+		}
+		if item.stale(time.Now()) {
+			w.Header().Set(StaleHeader, "true")
+		}
+	} else {
+		item, ok = g.Lookup(key)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	writeValidators(w, item)
+	tag := item.ETag
+	encoding := item.Encoding()
+	encoded := encoding != "" && acceptsEncoding(r, encoding)
+	if encoding != "" {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if encoded {
+		tag = encodedETag(item.ETag, encoding)
+		w.Header().Set("ETag", tag)
+	}
+	if notModified(r, item, tag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+	writeMeta(w, item.Meta)
+	if len(item.Tags) > 0 {
+		w.Header().Set(TagsHeader, strings.Join(item.Tags, ", "))
+	}
+	data := item.Data
+	switch {
+	case encoded:
+		w.Header().Set("Content-Encoding", encoding)
+	case encoding != "":
+		decoded, err := item.Decode()
+		if err != nil {
+			h.logger.Log(LevelError, "cannot decode value", F("ns", ns), F("key", key), F("error", err))
+			http.Error(w, "error when decoding value", http.StatusInternalServerError)
+			return
+		}
+		data = decoded
+	}
+	// Values are never modified once cached, so they are streamed as they
+	// are. Range requests are served as well
+	http.ServeContent(w, r, "", item.Modified, bytes.NewReader(data))
+}
+
+// handleHead replies the headers of the key along with its usage, without
+// promoting it nor loading it if missing
+func (h *Hub) handleHead(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	g, ok := h.group(nsFromContext(ctx))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key := keyFromContext(ctx)
+	item, ok := g.Peek(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, ok := g.Inspect(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeValidators(w, item)
+	if notModified(r, item, item.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeMeta(w, item.Meta)
+	if len(item.Tags) > 0 {
+		w.Header().Set(TagsHeader, strings.Join(item.Tags, ", "))
+	}
+	writeKeyInfo(w, info)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleInspect replies the description of the key as JSON, without
+// promoting it nor loading it if missing
+func (h *Hub) handleInspect(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ns := nsFromContext(ctx)
+	g, ok := h.group(ns)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, ok := g.Inspect(keyFromContext(ctx))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		h.logger.Log(LevelWarn, "cannot write response", F("ns", ns), F("error", err))
+	}
+}
+
+// responseRecorder remembers the status code and the amount of bytes
+// written to the response, for access logging purposes
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.logger.Log(LevelDebug, "request received", F("method", r.Method), F("path", r.URL.Path))
+	if !h.accessLog {
+		h.router.ServeHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.router.ServeHTTP(recorder, r)
+	fields := []Field{F("method", r.Method), F("path", r.URL.Path)}
+	if t, err := parseTarget(r); err == nil {
+		fields = append(fields, F("ns", t.ns))
+		if t.hasKey {
+			fields = append(fields, F("key", t.key))
+		}
+	}
+	fields = append(fields,
+		F("status", recorder.status),
+		F("latency", time.Since(start)),
+		F("bytes", recorder.bytes),
+	)
+	h.logger.Log(LevelInfo, "request served", fields...)
+}
+
+// routes registers every endpoint of the hub
+func (h *Hub) routes() *router {
+	rt := newRouter()
+	rt.hub(http.MethodGet, statsPath, h.handleStats)
+	rt.group(http.MethodGet, h.handleGroupInfo)
+	rt.group(http.MethodPut, h.handleCreateGroup)
+	rt.group(http.MethodDelete, h.handleRemoveGroup)
+	rt.list(http.MethodGet, h.handleScan)
+	rt.action(http.MethodPost, mgetKey, h.handleMGet)
+	rt.action(http.MethodPost, msetKey, h.handleMSet)
+	rt.action(http.MethodPost, invalidateKey, h.handleInvalidate)
+	rt.key(http.MethodGet, h.handleGet)
+	rt.key(http.MethodHead, h.handleHead)
+	rt.key(http.MethodPost, h.handleAdd)
+	rt.key(http.MethodPut, h.handleSet)
+	rt.key(http.MethodDelete, h.handleRemove)
+	return rt
+}
+
+// canceled tells whether the client went away, in which case there is no
+// point in carrying on with the request
+func (h *Hub) canceled(ctx context.Context) bool {
+	if err := ctx.Err(); err != nil {
+		h.logger.Log(LevelDebug, "request canceled", F("ns", nsFromContext(ctx)), F("error", err))
+		return true
+	}
+	return false
+}
+
+// groupFromRequest returns the group, creating it with the configuration
+// params of the request if it does not exist yet
+func (h *Hub) groupFromRequest(ns string, r *http.Request) (*group, error) {
+	if g, ok := h.group(ns); ok {
+		return g, nil
+	}
+	if err := h.checkCapacity(r); err != nil {
+		return nil, err
+	}
+	g, _ := h.createGroup(ns, readGroupConfig(r))
+	return g, nil
+}
+
+// readGroupConfig reads the configuration params of a group. Invalid ones
+// fall back to their defaults
+func readGroupConfig(r *http.Request) GroupConfig {
+	capacity := readCapacity(r)
+	return GroupConfig{
+		Cap:        capacity,
+		Ct:         readEngine(r),
+		Shards:     readShards(r),
+		Codec:      readCodec(r),
+		MaxPinned:  readMaxPinned(r),
+		MaxEntries: readMaxEntries(r),
+		Weight:     readWeight(r),
+		Admission:  readAdmission(r, capacity),
 	}
 }
 
@@ -106,3 +577,113 @@ func readEngine(r *http.Request) engines.CacheType {
 	}
 	return eng
 }
+
+func readShards(r *http.Request) int {
+	rawshards := r.URL.Query().Get("shards")
+	if rawshards == "" {
+		return 1
+	}
+	shards, err := strconv.Atoi(rawshards)
+	if err != nil || shards < 1 {
+		return 1
+	}
+	return shards
+}
+
+func readMaxPinned(r *http.Request) float64 {
+	fraction, err := strconv.ParseFloat(r.URL.Query().Get("maxpinned"), 64)
+	if err != nil {
+		return 0
+	}
+	return fraction
+}
+
+// readMaxEntries reads the bound on keys of a group, zero if unbounded or
+// invalid
+func readMaxEntries(r *http.Request) uint64 {
+	entries, err := strconv.ParseUint(r.URL.Query().Get("maxentries"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return entries
+}
+
+// readWeight reads the share of the memory budget of a group, zero if
+// invalid or not finite so that it defaults
+func readWeight(r *http.Request) float64 {
+	weight, err := strconv.ParseFloat(r.URL.Query().Get("weight"), 64)
+	if err != nil || weight < 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		return 0
+	}
+	return weight
+}
+
+// readAdmission reads the admission policies of a group: the fraction of
+// the capacity keys may take, the probability with which they are admitted
+// and how many keys the doorkeeper is sized for, which is bounded by the
+// capacity, see bytesPerDoorkeeperKey. Invalid ones are ignored
+func readAdmission(r *http.Request, capacity uint64) []Admission {
+	query := r.URL.Query()
+	var policies []Admission
+	if fraction, err := strconv.ParseFloat(query.Get("maxsize"), 64); err == nil && fraction > 0 {
+		policies = append(policies, NewSizeAdmission(fraction))
+	}
+	if keys, err := strconv.ParseUint(query.Get("doorkeeper"), 10, 64); err == nil && keys > 0 {
+		if capacity == 0 {
+			capacity = DefaultMaxGroupCapacity
+		}
+		if limit := capacity / bytesPerDoorkeeperKey; keys > limit {
+			keys = limit
+		}
+		policies = append(policies, NewDoorkeeper(keys))
+	}
+	if probability, err := strconv.ParseFloat(query.Get("admitprob"), 64); err == nil && probability > 0 && probability < 1 {
+		policies = append(policies, NewProbabilisticAdmission(probability))
+	}
+	return policies
+}
+
+// readItem gathers the value written along with the attributes sent in
+// the request
+func readItem(r *http.Request, content MemoryView) *Item {
+	return &Item{
+		Data:   content,
+		Meta:   readMeta(r),
+		Tags:   readTags(r),
+		Pinned: readPin(r),
+		Cost:   readCost(r),
+	}
+}
+
+// readPin tells whether the value written is to be pinned, which is the
+// case if the pin flag is given with no value or a true one
+func readPin(r *http.Request) bool {
+	query := r.URL.Query()
+	if _, ok := query["pin"]; !ok {
+		return false
+	}
+	if query.Get("pin") == "" {
+		return true
+	}
+	pin, _ := strconv.ParseBool(query.Get("pin"))
+	return pin
+}
+
+// readCount returns how many keys a page of a scan lists
+func readCount(r *http.Request) (int, error) {
+	rawcount := r.URL.Query().Get("count")
+	if rawcount == "" {
+		return DefaultScanCount, nil
+	}
+	count, err := strconv.Atoi(rawcount)
+	if err != nil || count < 1 || count > MaxScanCount {
+		return 0, fmt.Errorf("invalid count '%s': must be between 1 and %d", rawcount, MaxScanCount)
+	}
+	return count, nil
+}
+
+// readCodec returns nil, hence no compression, unless a known codec is given
+func readCodec(r *http.Request) codec.Codec {
+	c, _ := codec.Lookup(r.URL.Query().Get("codec"))
+	return c
+}
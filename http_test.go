@@ -1,10 +1,13 @@
 package mecachis
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/sonirico/mecachis/batch"
 	"github.com/sonirico/mecachis/engines"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -145,3 +148,231 @@ func TestHub_ServeHTTP_LRU_engine_eviction(t *testing.T) {
 		t.Errorf("unexpected cache result. expected eviction, have '%s'", val.String())
 	}
 }
+
+func TestHub_ServeHTTP_MaxEntries(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPut, "/mecachis/sessions?engi=lfu&maxentries=2", "", nil)
+	for _, key := range []string{"a", "b", "c"} {
+		conditionalRequest(hub, http.MethodPost, "/mecachis/sessions/"+key, "token", nil)
+	}
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/sessions", "", nil)
+	want := `{"ns":"sessions","cap":2048,"max_entries":2,"engine":"lfu","shards":1,"size":12}`
+	if have := strings.TrimSpace(recorder.Body.String()); have != want {
+		t.Errorf("unexpected response body. want '%s', have '%s'", want, have)
+	}
+}
+
+func TestHub_ServeHTTP_Set_Remove(t *testing.T) {
+	actions := []action{
+		{method: http.MethodPost, endpoint: "/mecachis/metrics/mem", payload: "13gb"},
+		{method: http.MethodPut, endpoint: "/mecachis/metrics/mem", payload: "14gb"},
+		{method: http.MethodPut, endpoint: "/mecachis/metrics/ping", payload: "10ms"},
+		{method: http.MethodDelete, endpoint: "/mecachis/metrics/ping"},
+	}
+
+	hub := NewHub()
+	prepareHub(t, hub, actions)
+
+	group, _ := hub.group("metrics")
+	if val, _ := group.Get("mem"); val.String() != "14gb" {
+		t.Errorf("unexpected cache result. want '14gb', have '%s'", val.String())
+	}
+	if val, ok := group.Get("ping"); ok {
+		t.Errorf("unexpected cache result. expected removal, have '%s'", val.String())
+	}
+}
+
+func TestHub_ServeHTTP_Groups(t *testing.T) {
+	tests := []testCase{
+		{
+			name:       "info of non-existent group",
+			action:     &action{endpoint: "/mecachis/myapp", method: http.MethodGet},
+			want:       "404 page not found",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "info of existent group",
+			action:     &action{endpoint: "/mecachis/monitoring", method: http.MethodGet},
+			want:       `{"ns":"monitoring","cap":0,"engine":"lru","shards":1,"size":17}`,
+			wantStatus: http.StatusOK,
+			state:      &state{group: "monitoring", key: "sla", value: "perfdata: 100%"},
+		},
+		{
+			name:       "create existent group",
+			action:     &action{endpoint: "/mecachis/monitoring", method: http.MethodPut},
+			want:       "group 'monitoring' already exists",
+			wantStatus: http.StatusConflict,
+			state:      &state{group: "monitoring", key: "sla", value: "perfdata: 100%"},
+		},
+		{
+			name:       "create group",
+			action:     &action{endpoint: "/mecachis/myapp?cap=64", method: http.MethodPut},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "remove existent group",
+			action:     &action{endpoint: "/mecachis/monitoring", method: http.MethodDelete},
+			wantStatus: http.StatusNoContent,
+			state:      &state{group: "monitoring", key: "sla", value: "perfdata: 100%"},
+		},
+		{
+			name:       "remove non-existent group",
+			action:     &action{endpoint: "/mecachis/myapp", method: http.MethodDelete},
+			want:       "404 page not found",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action := test.action
+			request := httptest.NewRequest(action.method, action.endpoint, strings.NewReader(action.payload))
+			responseRecorder := httptest.NewRecorder()
+
+			hub := NewHub()
+			if test.state != nil {
+				g, _ := hub.getOrCreateGroup(test.state.group)
+				_ = g.Add(test.state.key, MemoryView(test.state.value))
+			}
+			hub.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d",
+					test.wantStatus, responseRecorder.Code)
+			}
+
+			cleanedBody := strings.TrimSpace(responseRecorder.Body.String())
+			if cleanedBody != test.want {
+				t.Errorf("unexpected response body. want '%s', have '%s'",
+					test.want, cleanedBody)
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_MSet_MGet(t *testing.T) {
+	hub := NewHub()
+
+	var payload bytes.Buffer
+	_ = batch.WritePairs(&payload, []batch.Pair{
+		{Key: "mem", Value: []byte("13gb")},
+		{Key: "mem", Value: []byte("14gb")},
+	})
+	request := httptest.NewRequest(http.MethodPost, "/mecachis/metrics/_mset", &payload)
+	recorder := httptest.NewRecorder()
+	hub.ServeHTTP(recorder, request)
+
+	results, err := batch.ReadResults(recorder.Body)
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	want := []batch.Result{
+		{Status: http.StatusCreated, Value: []byte{}},
+		{Status: http.StatusConflict, Value: []byte{}},
+	}
+	if !reflect.DeepEqual(want, results) {
+		t.Errorf("unexpected results. want %v, have %v", want, results)
+	}
+
+	payload.Reset()
+	_ = batch.WriteKeys(&payload, []string{"ping", "mem"})
+	request = httptest.NewRequest(http.MethodPost, "/mecachis/metrics/_mget", &payload)
+	recorder = httptest.NewRecorder()
+	hub.ServeHTTP(recorder, request)
+
+	results, err = batch.ReadResults(recorder.Body)
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	want = []batch.Result{
+		{Status: http.StatusNotFound, Value: []byte{}},
+		{Status: http.StatusOK, Value: []byte("13gb")},
+	}
+	if !reflect.DeepEqual(want, results) {
+		t.Errorf("unexpected results. want %v, have %v", want, results)
+	}
+}
+
+func TestHub_ServeHTTP_MGet_Malformed(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/mecachis/metrics/_mget", strings.NewReader("\x00\x00"))
+	recorder := httptest.NewRecorder()
+	NewHub().ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestHub_ServeHTTP_Stats(t *testing.T) {
+	actions := []action{
+		{method: http.MethodPost, endpoint: "/mecachis/metrics/mem", payload: "13gb"},
+		{method: http.MethodGet, endpoint: "/mecachis/metrics/mem"},
+	}
+	hub := NewHub()
+	prepareHub(t, hub, actions)
+
+	request := httptest.NewRequest(http.MethodGet, "/mecachis/_stats", nil)
+	recorder := httptest.NewRecorder()
+	hub.ServeHTTP(recorder, request)
+
+	want := `{"metrics":{"hits":1,"misses":0,"inserts":1,"duplicate_inserts":0,` +
+		`"evictions":{"budget":0,"capacity":0,"expired":0,"removed":0,"replaced":0},"bytes":7,"entries":1}}`
+	if have := strings.TrimSpace(recorder.Body.String()); have != want {
+		t.Errorf("unexpected response body. want '%s', have '%s'", want, have)
+	}
+}
+
+func TestHub_ServeHTTP_Compression(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	value := strings.Repeat(`{"cpu":98,"mem":"13gb"},`, 32)
+	conditionalRequest(hub, http.MethodPost, "/mecachis/metrics/host?codec=zstd", value, nil)
+
+	tests := []struct {
+		name         string
+		accept       string
+		wantEncoding string
+	}{
+		{name: "without Accept-Encoding", wantEncoding: ""},
+		{name: "with another encoding accepted", accept: "gzip, br", wantEncoding: ""},
+		{name: "with the encoding refused", accept: "zstd;q=0", wantEncoding: ""},
+		{name: "with the encoding accepted", accept: "gzip, zstd;q=0.5", wantEncoding: "zstd"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			headers := map[string]string{"Accept-Encoding": test.accept}
+			recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/metrics/host", "", headers)
+			if have := recorder.Header().Get("Content-Encoding"); have != test.wantEncoding {
+				t.Errorf("unexpected Content-Encoding header. want '%s', have '%s'", test.wantEncoding, have)
+			}
+			if test.wantEncoding == "" && recorder.Body.String() != value {
+				t.Errorf("unexpected response body. want '%s', have '%s'", value, recorder.Body.String())
+			}
+			if test.wantEncoding != "" && recorder.Body.Len() >= len(value) {
+				t.Errorf("expected a compressed body. want less than %d bytes, have %d", len(value), recorder.Body.Len())
+			}
+		})
+	}
+
+	// Encoded responses carry an entity tag of their own, which holds for
+	// conditional reads of them and for conditional writes of the value
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/metrics/host", "", map[string]string{"Accept-Encoding": "zstd"})
+	tag := recorder.Header().Get("ETag")
+	if want := encodedETag(etag([]byte(value)), "zstd"); tag != want {
+		t.Errorf("unexpected ETag header. want '%s', have '%s'", want, tag)
+	}
+	if have := recorder.Header().Get("Vary"); have != "Accept-Encoding" {
+		t.Errorf("unexpected Vary header. want '%s', have '%s'", "Accept-Encoding", have)
+	}
+	recorder = conditionalRequest(hub, http.MethodGet, "/mecachis/metrics/host", "", map[string]string{"Accept-Encoding": "zstd", "If-None-Match": tag})
+	if recorder.Code != http.StatusNotModified {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusNotModified, recorder.Code)
+	}
+	recorder = conditionalRequest(hub, http.MethodGet, "/mecachis/metrics/host", "", map[string]string{"If-None-Match": tag})
+	if recorder.Code != http.StatusOK {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusOK, recorder.Code)
+	}
+	recorder = conditionalRequest(hub, http.MethodPut, "/mecachis/metrics/host", "13gb", map[string]string{"If-Match": tag})
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusNoContent, recorder.Code)
+	}
+}
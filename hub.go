@@ -1,20 +1,92 @@
 package mecachis
 
 import (
+	"os"
 	"sync"
 )
 
 type Hub struct {
 	mx     sync.RWMutex
 	groups map[string]*group
+	router *router
+
+	logger    Logger
+	accessLog bool
+
+	maxValueSize     int64
+	maxGroupCapacity uint64
+	maxBatchLen      int
+	budget           *budget
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		groups: make(map[string]*group),
+type Option func(*Hub)
+
+// WithLogger replaces the default logger, which writes records of level
+// info and above to stderr. Pass NopLogger() to silence the hub
+func WithLogger(logger Logger) Option {
+	return func(h *Hub) {
+		h.logger = logger
 	}
 }
 
+// WithAccessLog logs every request served, along with its outcome, at
+// level info
+func WithAccessLog() Option {
+	return func(h *Hub) {
+		h.accessLog = true
+	}
+}
+
+// WithMaxValueSize bounds the values requests may write, in bytes. Larger
+// ones are rejected with 413. Zero lifts the limit
+func WithMaxValueSize(size int64) Option {
+	return func(h *Hub) {
+		h.maxValueSize = size
+	}
+}
+
+// WithMaxGroupCapacity bounds the capacity requests may create groups with,
+// as well as the size of batch writes, in bytes. Zero lifts the limit
+func WithMaxGroupCapacity(capacity uint64) Option {
+	return func(h *Hub) {
+		h.maxGroupCapacity = capacity
+	}
+}
+
+// WithMaxBatchLen sizes the bodies of batch requests for so many keys or
+// pairs, of the maximum key length and value size. Larger bodies are
+// rejected with 413. Zero lifts the limit
+func WithMaxBatchLen(n int) Option {
+	return func(h *Hub) {
+		h.maxBatchLen = n
+	}
+}
+
+// WithMemoryBudget bounds the bytes every group takes altogether. Once
+// exceeded, entries are evicted from the group the most over its share of
+// the budget, see GroupConfig.Weight. Keys remembered as not found are not
+// accounted, see GroupConfig.NegativeCap. Zero lifts the limit
+func WithMemoryBudget(size uint64) Option {
+	return func(h *Hub) {
+		h.budget = newBudget(size, h.snapshot)
+	}
+}
+
+func NewHub(opts ...Option) *Hub {
+	h := &Hub{
+		groups:           make(map[string]*group),
+		logger:           NewStdLogger(os.Stderr, LevelInfo),
+		maxValueSize:     DefaultMaxValueSize,
+		maxGroupCapacity: DefaultMaxGroupCapacity,
+		maxBatchLen:      DefaultMaxBatchLen,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.router = h.routes()
+	return h
+}
+
 func (h *Hub) group(name string) (*group, bool) {
 	h.mx.RLock()
 	defer h.mx.RUnlock()
@@ -26,9 +98,72 @@ func (h *Hub) getOrCreateGroup(name string) (*group, bool) {
 	if g, ok := h.group(name); ok {
 		return g, false
 	}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if g, ok := h.groups[name]; ok {
+		return g, false
+	}
 	g := newGroup(name)
+	g.budget = h.budget
+	h.groups[name] = g
+	return g, true
+}
+
+// CreateGroup creates the group ns, which is how groups backed by a loader
+// are set up. Returns *ErrDuplicatedGroup if it exists already
+func (h *Hub) CreateGroup(ns string, cfg GroupConfig) error {
+	if err := validateNs(ns); err != nil {
+		return err
+	}
+	if _, created := h.createGroup(ns, cfg); !created {
+		return NewDuplicatedGroupError(ns)
+	}
+	return nil
+}
+
+func (h *Hub) createGroup(name string, cfg GroupConfig) (*group, bool) {
 	h.mx.Lock()
+	defer h.mx.Unlock()
+	if g, ok := h.groups[name]; ok {
+		return g, false
+	}
+	g := newGroup(name)
+	g.GroupConfig = cfg
+	g.budget = h.budget
+	if g.Shards < 1 {
+		g.Shards = 1
+	}
 	h.groups[name] = g
-	h.mx.Unlock()
 	return g, true
 }
+
+func (h *Hub) removeGroup(name string) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if _, ok := h.groups[name]; !ok {
+		return false
+	}
+	delete(h.groups, name)
+	return true
+}
+
+// snapshot returns the groups existing at the time of the call
+func (h *Hub) snapshot() []*group {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+	groups := make([]*group, 0, len(h.groups))
+	for _, g := range h.groups {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// Stats returns a snapshot of the counters of every group, by namespace
+func (h *Hub) Stats() map[string]Stats {
+	groups := h.snapshot()
+	stats := make(map[string]Stats, len(groups))
+	for _, g := range groups {
+		stats[g.Ns] = g.Stats()
+	}
+	return stats
+}
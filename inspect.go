@@ -0,0 +1,73 @@
+package mecachis
+
+import (
+	e "github.com/sonirico/mecachis/engines"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// SizeHeader carries the bytes the key takes in its group
+	SizeHeader = "X-Mecachis-Size"
+	// InsertedHeader carries the time the key was inserted into its engine
+	InsertedHeader = "X-Mecachis-Inserted"
+	// AccessedHeader carries the time the key was last read, if ever
+	AccessedHeader = "X-Mecachis-Accessed"
+	// AccessesHeader carries how many times the key was read
+	AccessesHeader = "X-Mecachis-Accesses"
+	// PinnedHeader is set if the key is exempt from eviction
+	PinnedHeader = "X-Mecachis-Pinned"
+)
+
+// KeyInfo describes a cached key, as told by Inspect
+type KeyInfo struct {
+	Key      string     `json:"key"`
+	Size     uint64     `json:"size"`
+	Inserted time.Time  `json:"inserted"`
+	Accessed *time.Time `json:"accessed,omitempty"`
+	Accesses uint64     `json:"accesses"`
+	Pinned   bool       `json:"pinned,omitempty"`
+	Cost     float64    `json:"cost"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Version  uint64     `json:"version"`
+	ETag     string     `json:"etag"`
+	Encoding string     `json:"encoding,omitempty"`
+	Tags     []string   `json:"tags,omitempty"`
+}
+
+func newKeyInfo(key string, item *Item, usage e.Info) KeyInfo {
+	info := KeyInfo{
+		Key:      key,
+		Size:     usage.Size,
+		Inserted: usage.Inserted,
+		Accesses: usage.Accesses,
+		Pinned:   usage.Pinned,
+		Cost:     item.RecomputeCost(),
+		Version:  item.Version(),
+		ETag:     item.ETag,
+		Encoding: item.Encoding(),
+		Tags:     item.Tags,
+	}
+	if !usage.Accessed.IsZero() {
+		info.Accessed = &usage.Accessed
+	}
+	if !item.Expires.IsZero() {
+		info.Expires = &item.Expires
+	}
+	return info
+}
+
+// writeKeyInfo sets the headers describing the usage of the key
+func writeKeyInfo(w http.ResponseWriter, info KeyInfo) {
+	header := w.Header()
+	header.Set(SizeHeader, strconv.FormatUint(info.Size, 10))
+	header.Set(InsertedHeader, info.Inserted.UTC().Format(http.TimeFormat))
+	if info.Accessed != nil {
+		header.Set(AccessedHeader, info.Accessed.UTC().Format(http.TimeFormat))
+	}
+	header.Set(AccessesHeader, strconv.FormatUint(info.Accesses, 10))
+	if info.Pinned {
+		header.Set(PinnedHeader, "true")
+	}
+}
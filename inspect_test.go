@@ -0,0 +1,100 @@
+package mecachis
+
+import (
+	"encoding/json"
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"testing"
+)
+
+func TestCache_Peek(t *testing.T) {
+	c := NewCache(4, engines.LRU)
+	_ = c.Add("a", MemoryView("1"))
+	_ = c.Add("b", MemoryView("2"))
+	if item, ok := c.Peek("a"); !ok || item.Data.String() != "1" {
+		t.Errorf("unexpected cache result. want '1', have %v", item)
+	}
+	_ = c.Add("c", MemoryView("3"))
+	if _, ok := c.Peek("a"); ok {
+		t.Errorf("unexpected cache result. expected peeked 'a' to be evicted")
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("unexpected stats. want no hits nor misses, have %+v", stats)
+	}
+}
+
+func TestCache_Inspect(t *testing.T) {
+	c := NewCache(0, engines.LRU)
+	_ = c.AddItem("user:1", &Item{Data: MemoryView("alice"), Tags: []string{"users"}})
+	c.Get("user:1")
+	c.Get("user:1")
+	info, ok := c.Inspect("user:1")
+	if !ok {
+		t.Fatalf("unexpected cache result. expected 'user:1' to be inspected")
+	}
+	size := uint64(len("user:1") + len("alice") + len("users"))
+	if info.Size != size || info.Accesses != 2 || info.Accessed == nil || info.Version == 0 {
+		t.Errorf("unexpected info. want %d bytes accessed twice, have %+v", size, info)
+	}
+	if again, _ := c.Inspect("user:1"); again.Accesses != 2 {
+		t.Errorf("unexpected accesses. want 2 as inspecting is no access, have %d", again.Accesses)
+	}
+}
+
+func TestCache_Writes_KeepUsage(t *testing.T) {
+	c := NewCache(4, engines.LRU, WithMaxPinned(1))
+	_ = c.Add("a", MemoryView("1"))
+	_ = c.Add("b", MemoryView("2"))
+	_ = c.Pin("a")
+	_ = c.Unpin("a")
+	_ = c.CompareAndSwap("a", 0, MemoryView("4"))
+	if info, _ := c.Inspect("a"); info.Accesses != 0 {
+		t.Errorf("unexpected accesses. want 0 as writes are no accesses, have %d", info.Accesses)
+	}
+	// "b" remains the most recently used, hence "a" goes first
+	_ = c.Add("c", MemoryView("5"))
+	if _, ok := c.Peek("a"); ok {
+		t.Errorf("unexpected cache result. expected 'a' to be evicted")
+	}
+}
+
+func TestHub_ServeHTTP_Inspect(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/users/user:1", "alice",
+		map[string]string{TagsHeader: "users"})
+	conditionalRequest(hub, http.MethodGet, "/mecachis/users/user:1", "", nil)
+
+	recorder := conditionalRequest(hub, http.MethodHead, "/mecachis/users/user:1", "", nil)
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+		t.Errorf("unexpected response. want 200 without body, have %d '%s'", recorder.Code, recorder.Body.String())
+	}
+	want := map[string]string{
+		SizeHeader:     "16",
+		AccessesHeader: "1",
+		TagsHeader:     "users",
+	}
+	for name, value := range want {
+		if have := recorder.Header().Get(name); have != value {
+			t.Errorf("unexpected %s header. want '%s', have '%s'", name, value, have)
+		}
+	}
+	if recorder.Header().Get(AccessedHeader) == "" || recorder.Header().Get("ETag") == "" {
+		t.Errorf("expected %s and ETag headers to be set", AccessedHeader)
+	}
+
+	recorder = conditionalRequest(hub, http.MethodGet, "/mecachis/users/user:1?meta", "", nil)
+	var info KeyInfo
+	if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	if info.Key != "user:1" || info.Size != 16 || info.Accesses != 1 || len(info.Tags) != 1 {
+		t.Errorf("unexpected info. want user:1 of 16 bytes accessed once, have %+v", info)
+	}
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		recorder = conditionalRequest(hub, method, "/mecachis/users/user:2?meta", "", nil)
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("unexpected status code. want %d, have %d", http.StatusNotFound, recorder.Code)
+		}
+	}
+}
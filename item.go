@@ -0,0 +1,178 @@
+package mecachis
+
+import (
+	"encoding/hex"
+	"github.com/sonirico/mecachis/codec"
+	"hash/fnv"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// lastVersion is shared by every cache so that versions never go backwards
+// for a key, even if its group is dropped and created again
+var lastVersion uint64
+
+func nextVersion() uint64 {
+	return atomic.AddUint64(&lastVersion, 1)
+}
+
+// Meta describes a value the way it was handed over to the cache, so that
+// it can be served back the same way
+type Meta struct {
+	ContentType     string
+	ContentEncoding string
+	// Headers are user defined and replayed verbatim
+	Headers http.Header
+	// Created is the time the key was first written. Replacing the value
+	// keeps it
+	Created time.Time
+}
+
+// Len returns the bytes taken by the metadata, which count toward the
+// capacity of the cache as much as the value does
+func (m Meta) Len() uint64 {
+	size := len(m.ContentType) + len(m.ContentEncoding)
+	for name, values := range m.Headers {
+		for _, value := range values {
+			size += len(name) + len(value)
+		}
+	}
+	return uint64(size)
+}
+
+// Item is what caches store in their engines: the value along with its
+// metadata and the attributes needed to revalidate it
+type Item struct {
+	Data MemoryView
+	Meta Meta
+	// Tags allow invalidating several keys at once
+	Tags []string
+	// Pinned exempts the key from eviction once written, see Cache.Pin
+	Pinned bool
+	// Cost is how expensive the value is to recompute, for cost-aware
+	// engines. Zero means one
+	Cost     float64
+	ETag     string
+	Modified time.Time
+	// Expires is the time the item stops being served. Zero means never
+	Expires time.Time
+
+	version uint64
+	// codec is the one Data is compressed with, if any
+	codec codec.Codec
+	// staleAt is the time a loaded item should be reloaded at, although it
+	// may be served until it expires. Zero means never
+	staleAt time.Time
+}
+
+func newItem(data MemoryView) *Item {
+	return &Item{Data: data}
+}
+
+// encode returns a copy of the item ready to be stamped. Validators are
+// always computed by the cache, on the value as written. Data is compressed
+// with c unless it is encoded already or compression does not pay off.
+// Caches encode before taking their lock, as compressing may take a while
+func (it *Item) encode(c codec.Codec) *Item {
+	encoded := *it
+	encoded.ETag = etag(it.Data)
+	encoded.codec = nil
+	if c != nil && it.Meta.ContentEncoding == "" {
+		if data, err := c.Encode(it.Data); err == nil && len(data) < len(it.Data) {
+			encoded.Data = data
+			encoded.codec = c
+		}
+	}
+	return &encoded
+}
+
+// stamp dates and versions an encoded item so that it is ready to be
+// stored, replacing the one given, if any. Caches stamp with their lock
+// held
+func (it *Item) stamp(previous *Item) *Item {
+	it.Modified = time.Now()
+	it.Meta.Created = it.Modified
+	if previous != nil {
+		it.Meta.Created = previous.Meta.Created
+	}
+	it.version = nextVersion()
+	return it
+}
+
+// etag returns a strong entity tag derived from the content
+func etag(data []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+func (it *Item) Value() interface{} {
+	return it.Data
+}
+
+// PinOnInsert implements engines.Pinnable
+func (it *Item) PinOnInsert() bool {
+	return it.Pinned
+}
+
+// RecomputeCost implements engines.Costly
+func (it *Item) RecomputeCost() float64 {
+	if it.Cost > 0 {
+		return it.Cost
+	}
+	return 1
+}
+
+func (it *Item) Len() uint64 {
+	size := it.Data.Len() + it.Meta.Len()
+	for _, tag := range it.Tags {
+		size += uint64(len(tag))
+	}
+	return size
+}
+
+func (it *Item) expired(now time.Time) bool {
+	return !it.Expires.IsZero() && !now.Before(it.Expires)
+}
+
+func (it *Item) stale(now time.Time) bool {
+	return !it.staleAt.IsZero() && !now.Before(it.staleAt)
+}
+
+// Encoding returns the name of the codec Data is compressed with, or an
+// empty string if it is stored as written
+func (it *Item) Encoding() string {
+	if it.codec == nil {
+		return ""
+	}
+	return it.codec.Name()
+}
+
+// Decode returns the value as written
+func (it *Item) Decode() (MemoryView, error) {
+	if it.codec == nil {
+		return it.Data, nil
+	}
+	return it.codec.Decode(it.Data)
+}
+
+// Version returns the compare-and-swap token of the item
+func (it *Item) Version() uint64 {
+	return it.version
+}
+
+// Condition decides whether a conditional write may go on, given the item
+// currently cached under the key, which is nil if there is none
+type Condition func(current *Item) bool
+
+// versionIs holds if the current item has the given version. Version zero
+// stands for a key which is not cached
+func versionIs(version uint64) Condition {
+	return func(current *Item) bool {
+		if current == nil {
+			return version == 0
+		}
+		return current.Version() == version
+	}
+}
@@ -0,0 +1,131 @@
+package mecachis
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+)
+
+const (
+	// DefaultMaxValueSize bounds the values a request may write, in bytes
+	DefaultMaxValueSize int64 = 1 << 20
+	// DefaultMaxGroupCapacity bounds the capacity a request may create a
+	// group with, in bytes. Batch writes are bounded by it as well, as a
+	// group cannot hold more than that anyway
+	DefaultMaxGroupCapacity uint64 = 1 << 30
+	// DefaultMaxBatchLen is how many keys or pairs batch bodies are sized
+	// for, see WithMaxBatchLen
+	DefaultMaxBatchLen = 128
+	// batchFrameHeader is the length prefix of every frame of batch bodies
+	batchFrameHeader = 4
+	// bytesPerDoorkeeperKey bounds the keys the doorkeeper of a group
+	// created over HTTP is sized for: one per so many bytes of capacity,
+	// which keeps the filter at about a seventh of the group
+	bytesPerDoorkeeperKey = 8
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitReader reads up to left bytes and remembers whether the body went
+// past them, so that callers can tell it apart from a truncated body
+type limitReader struct {
+	r        io.Reader
+	left     int64
+	exceeded bool
+}
+
+func newLimitReader(r io.Reader, limit int64) *limitReader {
+	return &limitReader{r: r, left: limit}
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.exceeded = true
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	return n, err
+}
+
+// readValue reads the body of the request, failing with *ErrTooLarge as
+// soon as it goes past the maximum value size
+func (h *Hub) readValue(r *http.Request) (MemoryView, error) {
+	if h.maxValueSize <= 0 {
+		return ioutil.ReadAll(r.Body)
+	}
+	if r.ContentLength > h.maxValueSize {
+		return nil, NewTooLargeError("value", uint64(h.maxValueSize))
+	}
+	body := newLimitReader(r.Body, h.maxValueSize)
+	content, err := ioutil.ReadAll(body)
+	if body.exceeded {
+		return nil, NewTooLargeError("value", uint64(h.maxValueSize))
+	}
+	return content, err
+}
+
+// batchKeysLimit returns how many bytes batch reads may carry: as many
+// keys of the maximum length as batches are sized for
+func (h *Hub) batchKeysLimit() int64 {
+	key := int64(batchFrameHeader + MaxKeyLength)
+	if h.maxBatchLen <= 0 || int64(h.maxBatchLen) > math.MaxInt64/key {
+		return math.MaxInt64
+	}
+	return int64(h.maxBatchLen) * key
+}
+
+// batchPairsLimit returns how many bytes batch writes may carry: as many
+// pairs of the maximum sizes as batches are sized for, and no more than a
+// group may hold
+func (h *Hub) batchPairsLimit() int64 {
+	limit := int64(math.MaxInt64)
+	if h.maxGroupCapacity > 0 && h.maxGroupCapacity <= math.MaxInt64 {
+		limit = int64(h.maxGroupCapacity)
+	}
+	if h.maxBatchLen <= 0 || h.maxValueSize <= 0 {
+		return limit
+	}
+	pair := 2*batchFrameHeader + MaxKeyLength + h.maxValueSize
+	if int64(h.maxBatchLen) < limit/pair {
+		limit = int64(h.maxBatchLen) * pair
+	}
+	return limit
+}
+
+// checkValues fails if any of the pairs is larger than the maximum value
+// size
+func (h *Hub) checkValues(kvs []KeyValue) error {
+	if h.maxValueSize <= 0 {
+		return nil
+	}
+	for _, kv := range kvs {
+		if int64(len(kv.Value)) > h.maxValueSize {
+			return NewTooLargeError("value", uint64(h.maxValueSize))
+		}
+	}
+	return nil
+}
+
+// checkCapacity fails if the request asks for a group larger than the
+// maximum group capacity. Unbounded groups, asked for with a zero capacity,
+// exceed any maximum
+func (h *Hub) checkCapacity(r *http.Request) error {
+	if h.maxGroupCapacity == 0 {
+		return nil
+	}
+	if capacity := readCapacity(r); capacity == 0 || capacity > h.maxGroupCapacity {
+		return NewTooLargeError("group capacity", h.maxGroupCapacity)
+	}
+	return nil
+}
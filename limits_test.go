@@ -0,0 +1,92 @@
+package mecachis
+
+import (
+	"bytes"
+	"github.com/sonirico/mecachis/batch"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chunked hides the length of the body, as clients streaming it do
+type chunked struct {
+	io.Reader
+}
+
+func TestHub_ServeHTTP_Limits(t *testing.T) {
+	var pairs bytes.Buffer
+	_ = batch.WritePairs(&pairs, []batch.Pair{{Key: "mem", Value: []byte("13gb")}, {Key: "disk", Value: []byte("1tb+")}})
+	var oversized bytes.Buffer
+	_ = batch.WritePairs(&oversized, []batch.Pair{{Key: "mem", Value: []byte("13gb")}, {Key: "disk", Value: []byte("1tb+ssd")}})
+	var keys bytes.Buffer
+	_ = batch.WriteKeys(&keys, []string{strings.Repeat("k", MaxKeyLength), strings.Repeat("k", MaxKeyLength)})
+	var key bytes.Buffer
+	_ = batch.WriteKeys(&key, []string{strings.Repeat("k", MaxKeyLength)})
+
+	tests := []struct {
+		name       string
+		method     string
+		endpoint   string
+		body       io.Reader
+		wantStatus int
+	}{
+		{name: "value within limit", method: http.MethodPost, endpoint: "/mecachis/metrics/mem?cap=64", body: strings.NewReader("13gb"), wantStatus: http.StatusCreated},
+		{name: "value over limit", method: http.MethodPost, endpoint: "/mecachis/metrics/mem", body: strings.NewReader("13gb+swap"), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "streamed value over limit", method: http.MethodPut, endpoint: "/mecachis/metrics/mem", body: chunked{strings.NewReader("13gb+swap")}, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "group within limit", method: http.MethodPut, endpoint: "/mecachis/metrics?cap=64", wantStatus: http.StatusCreated},
+		{name: "group over limit", method: http.MethodPut, endpoint: "/mecachis/metrics?cap=65", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "unbounded group over limit", method: http.MethodPut, endpoint: "/mecachis/metrics?cap=0", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "implicit group over limit", method: http.MethodPost, endpoint: "/mecachis/metrics/mem?cap=65", body: strings.NewReader("13gb"), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "batch within limit", method: http.MethodPost, endpoint: "/mecachis/metrics/_mset?cap=64", body: bytes.NewReader(pairs.Bytes()), wantStatus: http.StatusOK},
+		{name: "batch value over limit", method: http.MethodPost, endpoint: "/mecachis/metrics/_mset", body: bytes.NewReader(oversized.Bytes()), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "batch over limit", method: http.MethodPost, endpoint: "/mecachis/metrics/_mset", body: strings.NewReader(strings.Repeat("k", 65)), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "batch keys within limit", method: http.MethodPost, endpoint: "/mecachis/metrics/_mget", body: bytes.NewReader(key.Bytes()), wantStatus: http.StatusOK},
+		{name: "batch keys over limit", method: http.MethodPost, endpoint: "/mecachis/metrics/_mget", body: bytes.NewReader(keys.Bytes()), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewHub(WithLogger(NopLogger()), WithMaxValueSize(4), WithMaxGroupCapacity(64), WithMaxBatchLen(1))
+			request := httptest.NewRequest(test.method, test.endpoint, test.body)
+			recorder := httptest.NewRecorder()
+			hub.ServeHTTP(recorder, request)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d", test.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_Get_Range(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", "perfdata: 100%", nil)
+
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", map[string]string{"Range": "bytes=10-"})
+	if recorder.Code != http.StatusPartialContent {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusPartialContent, recorder.Code)
+	}
+	if recorder.Body.String() != "100%" {
+		t.Errorf("unexpected response body. want '100%%', have '%s'", recorder.Body.String())
+	}
+	if have := recorder.Header().Get("Content-Range"); have != "bytes 10-13/14" {
+		t.Errorf("unexpected Content-Range header. want 'bytes 10-13/14', have '%s'", have)
+	}
+
+	recorder = conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", map[string]string{"Range": "bytes=20-"})
+	if recorder.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusRequestedRangeNotSatisfiable, recorder.Code)
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	body := newLimitReader(strings.NewReader("13gb"), 4)
+	if content, err := ioutil.ReadAll(body); err != nil || string(content) != "13gb" || body.exceeded {
+		t.Errorf("unexpected read. want '13gb', have '%s', %v", content, err)
+	}
+	body = newLimitReader(strings.NewReader("13gb+swap"), 4)
+	if _, err := ioutil.ReadAll(body); err != errBodyTooLarge || !body.exceeded {
+		t.Errorf("unexpected error. want '%v', have '%v'", errBodyTooLarge, err)
+	}
+}
@@ -0,0 +1,137 @@
+package mecachis
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// MissHeader is set on 404s when the miss is authoritative, that is,
+	// when the loader of the group says the key does not exist
+	MissHeader = "X-Mecachis-Miss"
+	// authoritativeMiss is the value of MissHeader
+	authoritativeMiss = "authoritative"
+	// StaleHeader is set when a loaded value is served after going stale
+	StaleHeader = "X-Mecachis-Stale"
+)
+
+const (
+	// DefaultRefreshTimeout bounds background reloads unless told otherwise
+	DefaultRefreshTimeout = 30 * time.Second
+	// DefaultNegativeCap bounds the keys unbounded groups remember as not
+	// found, in bytes, unless told otherwise
+	DefaultNegativeCap uint64 = 1 << 20
+)
+
+// Loader fetches values missing from a group, which makes it read-through.
+// Loaders return *ErrKeyNotFound, possibly wrapped, for keys which do not
+// exist. Loaded values cost the milliseconds their load took, which is
+// what cost-aware engines weigh them by
+type Loader interface {
+	Load(ctx context.Context, key string) (MemoryView, error)
+}
+
+// LoaderFunc adapts a function to the Loader interface
+type LoaderFunc func(ctx context.Context, key string) (MemoryView, error)
+
+func (f LoaderFunc) Load(ctx context.Context, key string) (MemoryView, error) {
+	return f(ctx, key)
+}
+
+func isNotFound(err error) bool {
+	var notFound *ErrKeyNotFound
+	return errors.As(err, &notFound)
+}
+
+// load returns the item cached under key, loading it on a miss or once it
+// went stale, as configured for the group. Concurrent loads of the same key
+// share a single call to the loader, which runs with the context of the
+// first one. Keys not found are remembered for NegativeTTL, or until they
+// are written, during which *ErrKeyNotFound is returned right away
+func (g *group) load(ctx context.Context, key string) (*Item, error) {
+	cache := g.lazyCache()
+	now := time.Now()
+	item, cached := cache.Lookup(key)
+	if cached {
+		switch {
+		case !item.stale(now):
+			if g.RefreshAhead > 0 && !item.staleAt.IsZero() && !now.Before(item.staleAt.Add(-g.RefreshAhead)) {
+				g.refresh(key)
+			}
+			return item, nil
+		case now.Before(item.staleAt.Add(g.StaleWhileRevalidate)):
+			g.refresh(key)
+			return item, nil
+		}
+	} else if g.negative != nil {
+		if _, ok := g.negative.Lookup(key); ok {
+			return nil, NewKeyNotFoundError(key)
+		}
+	}
+	res, err := g.calls.Run(key, g.fetch(ctx, key))
+	if err != nil {
+		if cached && !isNotFound(err) && now.Before(item.staleAt.Add(g.StaleIfError)) {
+			return item, nil
+		}
+		return nil, err
+	}
+	return res.(*Item), nil
+}
+
+// refresh reloads the key in the background, unless it is being reloaded
+// already, for up to RefreshTimeout. Failures leave the cached item as it is
+func (g *group) refresh(key string) {
+	if _, busy := g.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	timeout := g.RefreshTimeout
+	if timeout <= 0 {
+		timeout = DefaultRefreshTimeout
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, _ = g.calls.Run(key, g.fetch(ctx, key))
+	}()
+}
+
+// fetch returns the call to the loader for key, which caches its outcome
+func (g *group) fetch(ctx context.Context, key string) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		started := time.Now()
+		value, err := g.Loader.Load(ctx, key)
+		now := time.Now()
+		if isNotFound(err) {
+			// Stale values of keys which no longer exist must not be served
+			_ = g.lazyCache().Remove(key)
+			if g.negative != nil {
+				marker := &Item{Expires: now.Add(g.NegativeTTL)}
+				_, _ = g.negative.SetItem(key, marker, nil)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		item := &Item{Data: value, Cost: float64(now.Sub(started)) / float64(time.Millisecond)}
+		if g.TTL > 0 {
+			item.staleAt = now.Add(g.TTL)
+			grace := g.StaleWhileRevalidate
+			if g.StaleIfError > grace {
+				grace = g.StaleIfError
+			}
+			item.Expires = item.staleAt.Add(grace)
+		}
+		stored, err := g.lazyCache().SetItem(key, item, nil)
+		if isRejected(err) {
+			// Loaded values left out by admission are served all the same,
+			// they just do not get cached
+			return item.encode(nil).stamp(nil), nil
+		}
+		if err == nil {
+			g.written(key, uint64(len(key))+item.Len())
+		}
+		return stored, err
+	}
+}
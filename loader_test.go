@@ -0,0 +1,372 @@
+package mecachis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inventory loads the stock of products, which are not found unless they
+// start with "sku-"
+func inventory(calls *int32) Loader {
+	return LoaderFunc(func(ctx context.Context, key string) (MemoryView, error) {
+		atomic.AddInt32(calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		switch {
+		case key == "broken":
+			return nil, errors.New("database is down")
+		case len(key) < 4 || key[:4] != "sku-":
+			return nil, fmt.Errorf("inventory: %w", NewKeyNotFoundError(key))
+		}
+		return MemoryView("42 units"), nil
+	})
+}
+
+func TestHub_ServeHTTP_Loader(t *testing.T) {
+	var calls int32
+	hub := NewHub(WithLogger(NopLogger()))
+	if err := hub.CreateGroup("stock", GroupConfig{Loader: inventory(&calls)}); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/stock/sku-1", "", nil)
+			if recorder.Code != http.StatusOK || recorder.Body.String() != "42 units" {
+				t.Errorf("unexpected response. want 200 '42 units', have %d '%s'", recorder.Code, recorder.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	conditionalRequest(hub, http.MethodGet, "/mecachis/stock/sku-1", "", nil)
+	if calls != 1 {
+		t.Errorf("unexpected loader calls. want 1, have %d", calls)
+	}
+
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/stock/broken", "", nil)
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusBadGateway, recorder.Code)
+	}
+}
+
+func TestHub_ServeHTTP_Loader_NegativeCaching(t *testing.T) {
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		wantCalls   int32
+	}{
+		{name: "without negative caching", wantCalls: 3},
+		{name: "with negative caching", negativeTTL: time.Minute, wantCalls: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int32
+			hub := NewHub(WithLogger(NopLogger()))
+			_ = hub.CreateGroup("stock", GroupConfig{Loader: inventory(&calls), NegativeTTL: test.negativeTTL})
+			for i := 0; i < 3; i++ {
+				recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/stock/discontinued", "", nil)
+				if recorder.Code != http.StatusNotFound {
+					t.Errorf("unexpected status code. want %d, have %d", http.StatusNotFound, recorder.Code)
+				}
+				if have := recorder.Header().Get(MissHeader); have != "authoritative" {
+					t.Errorf("unexpected %s header. want 'authoritative', have '%s'", MissHeader, have)
+				}
+			}
+			if calls != test.wantCalls {
+				t.Errorf("unexpected loader calls. want %d, have %d", test.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestGroup_Load_NegativeExpiry(t *testing.T) {
+	var calls int32
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{Cap: 1024, Loader: inventory(&calls), NegativeTTL: 20 * time.Millisecond})
+	g, _ := hub.group("stock")
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.load(context.Background(), "discontinued"); !isNotFound(err) {
+			t.Errorf("unexpected error. want ErrKeyNotFound, have %v", err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	_, _ = g.load(context.Background(), "discontinued")
+	if calls != 2 {
+		t.Errorf("unexpected loader calls. want 2 once the negative result expired, have %d", calls)
+	}
+	if size := g.negative.Size(); size != uint64(len("discontinued")) {
+		t.Errorf("unexpected negative cache size. want %d, have %d", len("discontinued"), size)
+	}
+	if size := g.Info().Size; size != 0 {
+		t.Errorf("unexpected group size. want 0 as misses have a budget of their own, have %d", size)
+	}
+}
+
+func TestGroup_Load_NegativeBounded(t *testing.T) {
+	var calls int32
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{Loader: inventory(&calls), NegativeTTL: time.Minute})
+	g, _ := hub.group("stock")
+
+	_, _ = g.load(context.Background(), "discontinued")
+	if have := g.negative.(*cache).capacity; have != DefaultNegativeCap {
+		t.Errorf("unexpected negative cache capacity. want %d, have %d", DefaultNegativeCap, have)
+	}
+}
+
+func TestGroup_Load_NegativeWritten(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(g *group) error
+	}{
+		{name: "add", write: func(g *group) error { return g.Add("discontinued", MemoryView("0 units")) }},
+		{name: "add item", write: func(g *group) error { return g.AddItem("discontinued", &Item{Data: MemoryView("0 units")}) }},
+		{name: "add many", write: func(g *group) error {
+			return g.AddMany([]KeyValue{{Key: "discontinued", Value: MemoryView("0 units")}})[0]
+		}},
+		{name: "set", write: func(g *group) error { return g.Set("discontinued", MemoryView("0 units")) }},
+		{name: "set if", write: func(g *group) error { return g.SetIf("discontinued", MemoryView("0 units"), versionIs(0)) }},
+		{name: "compare and swap", write: func(g *group) error { return g.CompareAndSwap("discontinued", 0, MemoryView("0 units")) }},
+		{name: "set item", write: func(g *group) error {
+			_, err := g.SetItem("discontinued", &Item{Data: MemoryView("0 units")}, nil)
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int32
+			hub := NewHub(WithLogger(NopLogger()))
+			_ = hub.CreateGroup("stock", GroupConfig{Cap: 1024, Loader: inventory(&calls), NegativeTTL: time.Minute})
+			g, _ := hub.group("stock")
+
+			_, _ = g.load(context.Background(), "discontinued")
+			if err := test.write(g); err != nil {
+				t.Fatalf("unexpected error. want nil, have %v", err)
+			}
+			_ = g.Remove("discontinued")
+			_, _ = g.load(context.Background(), "discontinued")
+			if calls != 2 {
+				t.Errorf("unexpected loader calls. want 2 once the key was written, have %d", calls)
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_Loader_Admission(t *testing.T) {
+	var calls int32
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{Loader: inventory(&calls), Admission: []Admission{NewDoorkeeper(100)}})
+	// The first load is served but not cached, the second one is both
+	for i := 0; i < 3; i++ {
+		recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/stock/sku-1", "", nil)
+		if recorder.Code != http.StatusOK || recorder.Body.String() != "42 units" {
+			t.Errorf("unexpected response. want 200 '42 units', have %d '%s'", recorder.Code, recorder.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("unexpected loader calls. want 2, have %d", calls)
+	}
+}
+
+func TestHub_CreateGroup(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	if err := hub.CreateGroup("stock", GroupConfig{}); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var dup *ErrDuplicatedGroup
+	if err := hub.CreateGroup("stock", GroupConfig{}); !errors.As(err, &dup) {
+		t.Errorf("unexpected error. want ErrDuplicatedGroup, have %v", err)
+	}
+	if err := hub.CreateGroup("_stock", GroupConfig{}); err == nil {
+		t.Errorf("expected an error for an invalid namespace")
+	}
+}
+
+// versioned loads a new version of the value on every call, failing once
+// failing is set
+type versioned struct {
+	calls   int32
+	failing int32
+}
+
+func (v *versioned) Load(ctx context.Context, key string) (MemoryView, error) {
+	calls := atomic.AddInt32(&v.calls, 1)
+	if atomic.LoadInt32(&v.failing) == 1 {
+		return nil, errors.New("database is down")
+	}
+	return MemoryView(fmt.Sprintf("v%d", calls)), nil
+}
+
+// waitCalls polls the loader until it was called want times
+func waitCalls(t *testing.T, loader *versioned, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&loader.calls) < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if have := atomic.LoadInt32(&loader.calls); have != want {
+		t.Fatalf("unexpected loader calls. want %d, have %d", want, have)
+	}
+}
+
+func loadValue(t *testing.T, g *group, key string) string {
+	t.Helper()
+	item, err := g.load(context.Background(), key)
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	return item.Data.String()
+}
+
+func TestGroup_Load_StaleWhileRevalidate(t *testing.T) {
+	loader := &versioned{}
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{
+		Loader:               loader,
+		TTL:                  20 * time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+	})
+	g, _ := hub.group("stock")
+
+	if have := loadValue(t, g, "sku-1"); have != "v1" {
+		t.Errorf("unexpected value. want 'v1', have '%s'", have)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 8; i++ {
+		if have := loadValue(t, g, "sku-1"); have != "v1" {
+			t.Errorf("unexpected value. want stale 'v1', have '%s'", have)
+		}
+	}
+	waitCalls(t, loader, 2)
+	time.Sleep(5 * time.Millisecond)
+	if have := loadValue(t, g, "sku-1"); have != "v2" {
+		t.Errorf("unexpected value. want revalidated 'v2', have '%s'", have)
+	}
+}
+
+func TestGroup_Load_RefreshAhead(t *testing.T) {
+	loader := &versioned{}
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{
+		Loader:       loader,
+		TTL:          100 * time.Millisecond,
+		RefreshAhead: 60 * time.Millisecond,
+	})
+	g, _ := hub.group("stock")
+
+	loadValue(t, g, "sku-1")
+	loadValue(t, g, "sku-1")
+	time.Sleep(5 * time.Millisecond)
+	if have := atomic.LoadInt32(&loader.calls); have != 1 {
+		t.Errorf("unexpected loader calls. want 1 before the refresh window, have %d", have)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if have := loadValue(t, g, "sku-1"); have != "v1" {
+		t.Errorf("unexpected value. want 'v1' while refreshing, have '%s'", have)
+	}
+	waitCalls(t, loader, 2)
+	time.Sleep(5 * time.Millisecond)
+	if have := loadValue(t, g, "sku-1"); have != "v2" {
+		t.Errorf("unexpected value. want refreshed 'v2', have '%s'", have)
+	}
+}
+
+func TestGroup_Load_RefreshTimeout(t *testing.T) {
+	var calls int32
+	canceled := make(chan error, 1)
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{
+		Loader: LoaderFunc(func(ctx context.Context, key string) (MemoryView, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return MemoryView("v1"), nil
+			}
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		}),
+		TTL:                  10 * time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+		RefreshTimeout:       20 * time.Millisecond,
+	})
+	g, _ := hub.group("stock")
+
+	loadValue(t, g, "sku-1")
+	time.Sleep(20 * time.Millisecond)
+	loadValue(t, g, "sku-1")
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("unexpected error. want context.DeadlineExceeded, have %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unexpected refresh. want it timed out, have it running")
+	}
+}
+
+func TestGroup_Load_StaleIfError(t *testing.T) {
+	tests := []struct {
+		name         string
+		staleIfError time.Duration
+		wantErr      bool
+	}{
+		{name: "without stale-if-error", wantErr: true},
+		{name: "with stale-if-error", staleIfError: time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loader := &versioned{}
+			hub := NewHub(WithLogger(NopLogger()))
+			_ = hub.CreateGroup("stock", GroupConfig{
+				Loader:       loader,
+				TTL:          10 * time.Millisecond,
+				StaleIfError: test.staleIfError,
+			})
+			g, _ := hub.group("stock")
+			loadValue(t, g, "sku-1")
+			atomic.StoreInt32(&loader.failing, 1)
+			time.Sleep(20 * time.Millisecond)
+
+			item, err := g.load(context.Background(), "sku-1")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("unexpected error. want error %v, have %v", test.wantErr, err)
+			}
+			if err == nil && item.Data.String() != "v1" {
+				t.Errorf("unexpected value. want stale 'v1', have '%s'", item.Data.String())
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_Loader_Stale(t *testing.T) {
+	loader := &versioned{}
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{Loader: loader, TTL: 10 * time.Millisecond, StaleWhileRevalidate: time.Minute})
+	conditionalRequest(hub, http.MethodGet, "/mecachis/stock/sku-1", "", nil)
+	time.Sleep(20 * time.Millisecond)
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/stock/sku-1", "", nil)
+	if have := recorder.Header().Get(StaleHeader); have != "true" {
+		t.Errorf("unexpected %s header. want 'true', have '%s'", StaleHeader, have)
+	}
+	waitCalls(t, loader, 2)
+}
+
+func TestGroup_Load_Cost(t *testing.T) {
+	var calls int32
+	hub := NewHub(WithLogger(NopLogger()))
+	_ = hub.CreateGroup("stock", GroupConfig{Ct: engines.GDSF, Loader: inventory(&calls)})
+	g, _ := hub.group("stock")
+	loadValue(t, g, "sku-1")
+	if info, _ := g.Inspect("sku-1"); info.Cost < 10 {
+		t.Errorf("unexpected cost. want the 10ms the load took at least, have %f", info.Cost)
+	}
+}
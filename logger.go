@@ -0,0 +1,102 @@
+package mecachis
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Field is a key-value pair attached to a log record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives every log record of the hub. Implementations are expected
+// to be safe for concurrent use
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...Field) {}
+
+// NopLogger discards every record. Useful to silence the hub in tests
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// stdLogger writes records in logfmt, one per line, skipping those below
+// the minimum level
+type stdLogger struct {
+	mx  sync.Mutex
+	w   io.Writer
+	min Level
+	now func() time.Time
+}
+
+func NewStdLogger(w io.Writer, min Level) Logger {
+	return &stdLogger{w: w, min: min, now: time.Now}
+}
+
+func (l *stdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(l.now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(quote(msg))
+	for _, field := range fields {
+		b.WriteByte(' ')
+		b.WriteString(field.Key)
+		b.WriteByte('=')
+		b.WriteString(quote(fmt.Sprint(field.Value)))
+	}
+	b.WriteByte('\n')
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	_, _ = io.WriteString(l.w, b.String())
+}
+
+// quote leaves simple values as they are and quotes the rest
+func quote(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+package mecachis
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStdLogger_Log(t *testing.T) {
+	var buf strings.Builder
+	logger := NewStdLogger(&buf, LevelInfo).(*stdLogger)
+	logger.now = func() time.Time {
+		return time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	logger.Log(LevelDebug, "request received", F("path", "/mecachis/ns/key"))
+	logger.Log(LevelWarn, "cannot read request body", F("ns", "metrics"), F("error", errors.New("unexpected EOF")))
+
+	want := `time=2021-01-02T03:04:05Z level=warn msg="cannot read request body" ns=metrics error="unexpected EOF"` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected log output. want '%s', have '%s'", want, buf.String())
+	}
+}
+
+type recordingLogger struct {
+	msgs   []string
+	fields [][]Field
+}
+
+func (l *recordingLogger) Log(level Level, msg string, fields ...Field) {
+	l.msgs = append(l.msgs, level.String()+" "+msg)
+	l.fields = append(l.fields, fields)
+}
+
+func TestHub_ServeHTTP_AccessLog(t *testing.T) {
+	logger := &recordingLogger{}
+	hub := NewHub(WithLogger(logger), WithAccessLog())
+
+	request := httptest.NewRequest(http.MethodPost, "/mecachis/metrics/mem", strings.NewReader("13gb"))
+	hub.ServeHTTP(httptest.NewRecorder(), request)
+
+	last := len(logger.msgs) - 1
+	if last < 0 || logger.msgs[last] != "info request served" {
+		t.Fatalf("expected an access log record, have %v", logger.msgs)
+	}
+	fields := make(map[string]interface{})
+	for _, field := range logger.fields[last] {
+		fields[field.Key] = field.Value
+	}
+	if fields["method"] != http.MethodPost || fields["ns"] != "metrics" || fields["key"] != "mem" ||
+		fields["status"] != http.StatusCreated || fields["bytes"] != 0 {
+		t.Errorf("unexpected access log fields. have %v", fields)
+	}
+	if _, ok := fields["latency"].(time.Duration); !ok {
+		t.Errorf("expected latency to be logged. have %v", fields)
+	}
+}
+
+func TestHub_ServeHTTP_NoAccessLog(t *testing.T) {
+	logger := &recordingLogger{}
+	hub := NewHub(WithLogger(logger))
+
+	request := httptest.NewRequest(http.MethodGet, "/mecachis/metrics/mem", nil)
+	hub.ServeHTTP(httptest.NewRecorder(), request)
+
+	for _, msg := range logger.msgs {
+		if msg == "info request served" {
+			t.Errorf("unexpected access log record")
+		}
+	}
+}
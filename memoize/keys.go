@@ -0,0 +1,32 @@
+package memoize
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Key derives a key from several values, such as the arguments of a
+// function. Parts are formatted in Go syntax and prefixed by their length,
+// so that distinct lists of values never make the same key
+func Key(parts ...interface{}) string {
+	var b strings.Builder
+	for _, part := range parts {
+		formatted := fmt.Sprintf("%#v", part)
+		b.WriteString(strconv.Itoa(len(formatted)))
+		b.WriteByte(':')
+		b.WriteString(formatted)
+	}
+	return b.String()
+}
+
+// HashKey derives a fixed length key from several values, for those which
+// would make keys too long otherwise. Unlike Key, it may collide, although
+// it is unlikely
+func HashKey(parts ...interface{}) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(Key(parts...)))
+	return hex.EncodeToString(h.Sum(nil))
+}
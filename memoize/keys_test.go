@@ -0,0 +1,27 @@
+package memoize
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []interface{}
+	}{
+		{name: "shifted separators", a: []interface{}{"a:b", "c"}, b: []interface{}{"a", "b:c"}},
+		{name: "distinct types", a: []interface{}{1}, b: []interface{}{"1"}},
+		{name: "distinct lengths", a: []interface{}{"ab"}, b: []interface{}{"a", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if Key(test.a...) == Key(test.b...) {
+				t.Errorf("expected distinct keys. have '%s' for both", Key(test.a...))
+			}
+			if HashKey(test.a...) == HashKey(test.b...) {
+				t.Errorf("expected distinct hash keys. have '%s' for both", HashKey(test.a...))
+			}
+		})
+	}
+	if Key("db", 1) != Key("db", 1) || len(HashKey("db", 1)) != 16 {
+		t.Errorf("expected keys to be stable")
+	}
+}
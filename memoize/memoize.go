@@ -0,0 +1,170 @@
+// Package memoize caches the results of functions, on top of typed caches,
+// so that concurrent calls for the same key run the function only once.
+package memoize
+
+import (
+	"context"
+	"github.com/sonirico/mecachis/engines"
+	"github.com/sonirico/mecachis/singlecall"
+	"github.com/sonirico/mecachis/typed"
+	"time"
+)
+
+// Func is the kind of function memoized. Calls for the same key are
+// expected to return the same value until it goes stale
+type Func[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+type options[K comparable, V any] struct {
+	cType       engines.CacheType
+	capacity    uint64
+	ttl         time.Duration
+	negativeTTL time.Duration
+	negative    func(err error) bool
+	sizer       typed.Sizer[V]
+	keyer       typed.Keyer[K]
+}
+
+// Option configures a Memo of functions taking keys of type K and returning
+// values of type V, so that options of other types do not compile
+type Option[K comparable, V any] func(*options[K, V])
+
+// WithEngine replaces the default engine, an unbounded LRU
+func WithEngine[K comparable, V any](cType engines.CacheType, capacity uint64) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cType = cType
+		o.capacity = capacity
+	}
+}
+
+// WithTTL expires results once they are older than ttl. By default, they
+// are kept until evicted
+func WithTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.ttl = ttl
+	}
+}
+
+// WithNegativeCaching keeps the errors matched by negative for ttl, so that
+// lookups known to fail, such as those for missing records, do not run the
+// function again. Other errors are never cached
+func WithNegativeCaching[K comparable, V any](ttl time.Duration, negative func(err error) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.negativeTTL = ttl
+		o.negative = negative
+	}
+}
+
+// WithSizer accounts values against the capacity of the engine
+func WithSizer[K comparable, V any](sizer func(value V) uint64) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.sizer = sizer
+	}
+}
+
+// WithKeyer replaces typed.DefaultKeyer
+func WithKeyer[K comparable, V any](keyer func(key K) string) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.keyer = keyer
+	}
+}
+
+// result is what is cached for each key: either a value or a negative
+// result
+type result[V any] struct {
+	value   V
+	err     error
+	expires time.Time
+}
+
+// Memo memoizes a function. It is safe for concurrent use
+type Memo[K comparable, V any] struct {
+	fn    Func[K, V]
+	cache *typed.Cache[K, *result[V]]
+	keyer typed.Keyer[K]
+	calls *singlecall.SingleCall
+	opts  options[K, V]
+	now   func() time.Time
+}
+
+// New memoizes fn. Returns *mecachis.ErrUnsupportedEngine for cache types
+// no engine implements
+func New[K comparable, V any](fn Func[K, V], opts ...Option[K, V]) (*Memo[K, V], error) {
+	o := options[K, V]{
+		cType: engines.LRU,
+		sizer: typed.DefaultSizer[V],
+		keyer: typed.DefaultKeyer[K],
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &Memo[K, V]{
+		fn:    fn,
+		keyer: o.keyer,
+		calls: singlecall.New(),
+		opts:  o,
+		now:   time.Now,
+	}
+	cache, err := typed.New[K, *result[V]](o.capacity, o.cType,
+		typed.WithKeyer[K, *result[V]](m.keyer),
+		typed.WithSizer[K](func(r *result[V]) uint64 {
+			if r.err != nil {
+				return 0
+			}
+			return o.sizer(r.value)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.cache = cache
+	return m, nil
+}
+
+// Wrap memoizes fn, returning a function with the same signature
+func Wrap[K comparable, V any](fn Func[K, V], opts ...Option[K, V]) (Func[K, V], error) {
+	m, err := New(fn, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return m.Call, nil
+}
+
+// Call returns the cached result for key, running the function if there is
+// none or it went stale. Concurrent calls for the same key wait for the
+// first one, which runs with its own context
+func (m *Memo[K, V]) Call(ctx context.Context, key K) (V, error) {
+	if r, ok := m.cache.Get(key); ok && !m.expired(r) {
+		return r.value, r.err
+	}
+	res, err := m.calls.Run(m.keyer(key), func() (interface{}, error) {
+		value, err := m.fn(ctx, key)
+		m.store(key, value, err)
+		return value, err
+	})
+	value, _ := res.(V)
+	return value, err
+}
+
+// Forget drops the result cached for key, if any
+func (m *Memo[K, V]) Forget(key K) {
+	_ = m.cache.Remove(key)
+}
+
+func (m *Memo[K, V]) expired(r *result[V]) bool {
+	return !r.expires.IsZero() && !m.now().Before(r.expires)
+}
+
+func (m *Memo[K, V]) store(key K, value V, err error) {
+	r := &result[V]{value: value, err: err}
+	ttl := m.opts.ttl
+	if err != nil {
+		if m.opts.negative == nil || !m.opts.negative(err) {
+			return
+		}
+		ttl = m.opts.negativeTTL
+	}
+	if ttl > 0 {
+		r.expires = m.now().Add(ttl)
+	}
+	m.cache.Set(key, r)
+}
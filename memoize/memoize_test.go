@@ -0,0 +1,133 @@
+package memoize
+
+import (
+	"context"
+	"errors"
+	"github.com/sonirico/mecachis"
+	"github.com/sonirico/mecachis/engines"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// counting returns a function which counts its calls, failing for keys
+// starting with a dash
+func counting(calls *int32, delay time.Duration) Func[string, int] {
+	return func(ctx context.Context, key string) (int, error) {
+		atomic.AddInt32(calls, 1)
+		time.Sleep(delay)
+		if key[0] == '-' {
+			return 0, errNotFound
+		}
+		return len(key), nil
+	}
+}
+
+func TestMemo_Call_Deduplicates(t *testing.T) {
+	var calls int32
+	fn, _ := Wrap(counting(&calls, 50*time.Millisecond))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := fn(context.Background(), "db-1"); value != 4 || err != nil {
+				t.Errorf("unexpected result. want 4, have %d, %v", value, err)
+			}
+		}()
+	}
+	wg.Wait()
+	_, _ = fn(context.Background(), "db-1")
+	if calls != 1 {
+		t.Errorf("unexpected calls. want 1, have %d", calls)
+	}
+}
+
+func TestMemo_Call_TTL(t *testing.T) {
+	var calls int32
+	now := time.Now()
+	m, _ := New(counting(&calls, 0), WithTTL[string, int](time.Minute))
+	m.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		elapsed   time.Duration
+		wantCalls int32
+	}{
+		{name: "first call", elapsed: 0, wantCalls: 1},
+		{name: "fresh result", elapsed: 59 * time.Second, wantCalls: 1},
+		{name: "stale result", elapsed: time.Minute, wantCalls: 2},
+		{name: "refreshed result", elapsed: time.Minute, wantCalls: 2},
+	}
+	start := now
+	for _, test := range tests {
+		now = start.Add(test.elapsed)
+		_, _ = m.Call(context.Background(), "db-1")
+		if calls != test.wantCalls {
+			t.Errorf("%s: unexpected calls. want %d, have %d", test.name, test.wantCalls, calls)
+		}
+	}
+}
+
+func TestMemo_Call_NegativeCaching(t *testing.T) {
+	var calls int32
+	now := time.Now()
+	m, _ := New(counting(&calls, 0),
+		WithNegativeCaching[string, int](time.Second, func(err error) bool { return errors.Is(err, errNotFound) }))
+	m.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := m.Call(context.Background(), "-db"); !errors.Is(err, errNotFound) {
+			t.Errorf("unexpected error. want %v, have %v", errNotFound, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("unexpected calls. want 1, have %d", calls)
+	}
+	now = now.Add(time.Second)
+	_, _ = m.Call(context.Background(), "-db")
+	if calls != 2 {
+		t.Errorf("unexpected calls. want 2 once the negative result expired, have %d", calls)
+	}
+}
+
+func TestMemo_Call_ErrorsNotCached(t *testing.T) {
+	var calls int32
+	fn, _ := Wrap(counting(&calls, 0))
+	_, _ = fn(context.Background(), "-db")
+	_, _ = fn(context.Background(), "-db")
+	if calls != 2 {
+		t.Errorf("unexpected calls. want 2, have %d", calls)
+	}
+}
+
+func TestMemo_Engine_Sizer(t *testing.T) {
+	var calls int32
+	m, _ := New(counting(&calls, 0),
+		WithEngine[string, int](engines.LRU, uint64(2*(len("db-1")+8))),
+		WithSizer[string](func(int) uint64 { return 8 }),
+		WithKeyer[string, int](func(key string) string { return key }),
+	)
+	for _, key := range []string{"db-1", "db-2", "db-3", "db-1"} {
+		_, _ = m.Call(context.Background(), key)
+	}
+	if calls != 4 {
+		t.Errorf("unexpected calls. want 4 as db-1 got evicted, have %d", calls)
+	}
+	m.Forget("db-1")
+	_, _ = m.Call(context.Background(), "db-1")
+	if calls != 5 {
+		t.Errorf("unexpected calls. want 5 after forgetting db-1, have %d", calls)
+	}
+}
+
+func TestNew_Unsupported(t *testing.T) {
+	var calls int32
+	var unsupported *mecachis.ErrUnsupportedEngine
+	if _, err := New(counting(&calls, 0), WithEngine[string, int](engines.MRU, 0)); !errors.As(err, &unsupported) {
+		t.Errorf("unexpected error. want ErrUnsupportedEngine, have %v", err)
+	}
+}
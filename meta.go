@@ -0,0 +1,90 @@
+package mecachis
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MetaHeaderPrefix starts the names of user headers which are stored
+	// along with the value and replayed when it is served
+	MetaHeaderPrefix = "X-Mecachis-Meta-"
+	// CreatedHeader carries the time the key was first written
+	CreatedHeader = "X-Mecachis-Created"
+	// CostHeader carries how expensive the value is to recompute, which
+	// cost-aware engines evict accordingly
+	CostHeader = "X-Mecachis-Cost"
+
+	defaultContentType = "application/octet-stream"
+)
+
+// readMeta captures the metadata of the value sent in the request. The
+// default content type is not stored, as it is replied anyway
+func readMeta(r *http.Request) Meta {
+	var meta Meta
+	if contentType := r.Header.Get("Content-Type"); contentType != defaultContentType {
+		meta.ContentType = contentType
+	}
+	meta.ContentEncoding = r.Header.Get("Content-Encoding")
+	for name, values := range r.Header {
+		if !strings.HasPrefix(name, MetaHeaderPrefix) {
+			continue
+		}
+		if meta.Headers == nil {
+			meta.Headers = make(http.Header)
+		}
+		meta.Headers[name] = append([]string(nil), values...)
+	}
+	return meta
+}
+
+// readCost returns the cost sent in the request. Missing, malformed,
+// negative and infinite costs are zero, hence the default one
+func readCost(r *http.Request) float64 {
+	cost, err := strconv.ParseFloat(r.Header.Get(CostHeader), 64)
+	if err != nil || cost < 0 || math.IsInf(cost, 0) || math.IsNaN(cost) {
+		return 0
+	}
+	return cost
+}
+
+// writeMeta replays the metadata of the item the way it was captured
+func writeMeta(w http.ResponseWriter, meta Meta) {
+	header := w.Header()
+	header.Set("Content-Type", defaultContentType)
+	if meta.ContentType != "" {
+		header.Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentEncoding != "" {
+		header.Set("Content-Encoding", meta.ContentEncoding)
+	}
+	for name, values := range meta.Headers {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set(CreatedHeader, meta.Created.UTC().Format(http.TimeFormat))
+}
+
+// acceptsEncoding tells whether the client accepts the content coding, as
+// per its Accept-Encoding header
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, token := range strings.Split(header, ",") {
+			parts := strings.Split(token, ";")
+			name := strings.TrimSpace(parts[0])
+			if name != encoding && name != "*" {
+				continue
+			}
+			q := 1.0
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					q, _ = strconv.ParseFloat(param[2:], 64)
+				}
+			}
+			return q > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package mecachis
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHub_ServeHTTP_Meta(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	headers := map[string]string{
+		"Content-Type":              "application/json",
+		"Content-Encoding":          "identity",
+		MetaHeaderPrefix + "Origin": "collector-1",
+		"X-Not-Meta":                "dropped",
+	}
+	conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", `{"p99":100}`, headers)
+
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", nil)
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "Content-Type", want: "application/json"},
+		{header: "Content-Encoding", want: "identity"},
+		{header: MetaHeaderPrefix + "Origin", want: "collector-1"},
+		{header: "X-Not-Meta", want: ""},
+	}
+	for _, test := range tests {
+		if have := recorder.Header().Get(test.header); have != test.want {
+			t.Errorf("unexpected %s header. want '%s', have '%s'", test.header, test.want, have)
+		}
+	}
+	created, err := http.ParseTime(recorder.Header().Get(CreatedHeader))
+	if err != nil || time.Since(created) > time.Minute {
+		t.Errorf("unexpected %s header. have '%s'", CreatedHeader, recorder.Header().Get(CreatedHeader))
+	}
+}
+
+func TestHub_ServeHTTP_Meta_Defaults(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", "perfdata: 100%", nil)
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/monitoring/sla", "", nil)
+	if have := recorder.Header().Get("Content-Type"); have != "application/octet-stream" {
+		t.Errorf("unexpected Content-Type header. want 'application/octet-stream', have '%s'", have)
+	}
+	if have := recorder.Header().Get("Content-Encoding"); have != "" {
+		t.Errorf("unexpected Content-Encoding header. want '', have '%s'", have)
+	}
+}
+
+func TestHub_ServeHTTP_Meta_Replace(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/monitoring/sla", "perfdata: 100%",
+		map[string]string{"Content-Type": "text/plain"})
+	g, _ := hub.group("monitoring")
+	before, _ := g.Lookup("sla")
+
+	conditionalRequest(hub, http.MethodPut, "/mecachis/monitoring/sla", `{"p99":99}`,
+		map[string]string{"Content-Type": "application/json"})
+	after, _ := g.Lookup("sla")
+	if after.Meta.ContentType != "application/json" {
+		t.Errorf("unexpected content type. want 'application/json', have '%s'", after.Meta.ContentType)
+	}
+	if !after.Meta.Created.Equal(before.Meta.Created) {
+		t.Errorf("unexpected creation time. want %s, have %s", before.Meta.Created, after.Meta.Created)
+	}
+}
+
+func TestCache_Meta_Capacity(t *testing.T) {
+	meta := Meta{ContentType: "text/plain", Headers: http.Header{MetaHeaderPrefix + "A": {"b"}}}
+	item := &Item{Data: MemoryView("13gb"), Meta: meta}
+	want := uint64(len("13gb") + len("text/plain") + len(MetaHeaderPrefix+"A") + len("b"))
+	if item.Len() != want {
+		t.Errorf("unexpected item length. want %d, have %d", want, item.Len())
+	}
+
+	// Entries account for their keys as well
+	size := uint64(len("mem")) + want + uint64(len("cpu")+len("8"))
+	c := NewCache(size, engines.LRU)
+	_ = c.AddItem("mem", item)
+	_ = c.Add("cpu", MemoryView("8"))
+	if c.Size() != size {
+		t.Errorf("unexpected cache size. want %d, have %d", size, c.Size())
+	}
+	_ = c.AddItem("disk", item)
+	if _, ok := c.Get("mem"); ok {
+		t.Errorf("unexpected cache result. expected 'mem' to be evicted")
+	}
+}
+
+func TestHub_ServeHTTP_Cost(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/reports/yearly?cap=64&engi=gdsf", "aggregated",
+		map[string]string{CostHeader: "500"})
+	for i := 0; i < 20; i++ {
+		conditionalRequest(hub, http.MethodPost, fmt.Sprintf("/mecachis/reports/daily-%d", i), "aggregated",
+			map[string]string{CostHeader: "malformed"})
+	}
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/reports/yearly?meta", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status code. want %d as the costly value is kept, have %d", http.StatusOK, recorder.Code)
+	}
+	var info KeyInfo
+	_ = json.NewDecoder(recorder.Body).Decode(&info)
+	if info.Cost != 500 {
+		t.Errorf("unexpected cost. want 500, have %f", info.Cost)
+	}
+	recorder = conditionalRequest(hub, http.MethodGet, "/mecachis/reports/daily-0?meta", "", nil)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code. want %d as cheap values are evicted first, have %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestReadCost(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want float64
+	}{
+		{raw: "500", want: 500},
+		{raw: "-1", want: 0},
+		{raw: "Inf", want: 0},
+		{raw: "NaN", want: 0},
+		{raw: "malformed", want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/mecachis/reports/yearly", nil)
+			r.Header.Set(CostHeader, test.raw)
+			if have := readCost(r); have != test.want {
+				t.Errorf("unexpected cost. want %v, have %v", test.want, have)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/sonirico/mecachis"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the request latency
+// histogram
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// Exporter renders the counters of every hub group, along with the latency
+// of the requests it instruments, in the Prometheus text format
+type Exporter struct {
+	hub     *mecachis.Hub
+	buckets []float64
+
+	mx       sync.Mutex
+	requests map[requestLabels]*histogram
+}
+
+type requestLabels struct {
+	method string
+	status int
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, value float64) {
+	for i, upper := range buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func NewExporter(hub *mecachis.Hub) *Exporter {
+	return &Exporter{
+		hub:      hub,
+		buckets:  DefaultBuckets,
+		requests: make(map[requestLabels]*histogram),
+	}
+}
+
+// Observe records how long a request took to be served
+func (e *Exporter) Observe(method string, status int, took time.Duration) {
+	labels := requestLabels{method: method, status: status}
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	h, ok := e.requests[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(e.buckets))}
+		e.requests[labels] = h
+	}
+	h.observe(e.buckets, took.Seconds())
+}
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Instrument wraps a handler so that the latency of every request is
+// observed by method and status code
+func (e *Exporter) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		e.Observe(r.Method, recorder.status, time.Since(start))
+	})
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if err := e.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type groupMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(mecachis.Stats) uint64
+}
+
+var groupMetrics = []groupMetric{
+	{
+		name:  "mecachis_hits_total",
+		kind:  "counter",
+		help:  "Lookups which found the key.",
+		value: func(s mecachis.Stats) uint64 { return s.Hits },
+	},
+	{
+		name:  "mecachis_misses_total",
+		kind:  "counter",
+		help:  "Lookups which did not find the key.",
+		value: func(s mecachis.Stats) uint64 { return s.Misses },
+	},
+	{
+		name:  "mecachis_inserts_total",
+		kind:  "counter",
+		help:  "Entries inserted.",
+		value: func(s mecachis.Stats) uint64 { return s.Inserts },
+	},
+	{
+		name:  "mecachis_duplicate_inserts_total",
+		kind:  "counter",
+		help:  "Insertions rejected because the key was cached already.",
+		value: func(s mecachis.Stats) uint64 { return s.DuplicateInserts },
+	},
+	{
+		name:  "mecachis_bytes",
+		kind:  "gauge",
+		help:  "Bytes used by cached entries.",
+		value: func(s mecachis.Stats) uint64 { return s.Bytes },
+	},
+	{
+		name:  "mecachis_entries",
+		kind:  "gauge",
+		help:  "Cached entries.",
+		value: func(s mecachis.Stats) uint64 { return s.Entries },
+	},
+}
+
+// Write renders every metric in the Prometheus text format
+func (e *Exporter) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	stats := e.hub.Stats()
+	namespaces := make([]string, 0, len(stats))
+	for ns := range stats {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, metric := range groupMetrics {
+		writeHeader(bw, metric.name, metric.kind, metric.help)
+		for _, ns := range namespaces {
+			fmt.Fprintf(bw, "%s{ns=\"%s\"} %d\n", metric.name, escape(ns), metric.value(stats[ns]))
+		}
+	}
+
+	writeHeader(bw, "mecachis_evictions_total", "counter", "Entries which left the cache, by reason.")
+	for _, ns := range namespaces {
+		evictions := stats[ns].Evictions
+		reasons := make([]string, 0, len(evictions))
+		for reason := range evictions {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Fprintf(bw, "mecachis_evictions_total{ns=\"%s\",reason=\"%s\"} %d\n",
+				escape(ns), escape(reason), evictions[reason])
+		}
+	}
+
+	e.writeRequests(bw)
+	return bw.Flush()
+}
+
+func (e *Exporter) writeRequests(w io.Writer) {
+	const name = "mecachis_http_request_duration_seconds"
+	writeHeader(w, name, "histogram", "Latency of the requests served by the hub.")
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	labels := make([]requestLabels, 0, len(e.requests))
+	for l := range e.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+		return labels[i].status < labels[j].status
+	})
+	for _, l := range labels {
+		h := e.requests[l]
+		base := fmt.Sprintf("method=\"%s\",status=\"%d\"", escape(l.method), l.status)
+		for i, upper := range e.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, base, formatFloat(upper), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, base, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, base, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, base, h.count)
+	}
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
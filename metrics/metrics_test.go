@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"github.com/sonirico/mecachis"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, handler http.Handler, method, endpoint, payload string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(method, endpoint, strings.NewReader(payload))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestExporter_GroupMetrics(t *testing.T) {
+	hub := mecachis.NewHub()
+	exporter := NewExporter(hub)
+	handler := exporter.Instrument(hub)
+	serve(t, handler, http.MethodPost, "/mecachis/metrics/mem?cap=14", "13gb") // +7
+	serve(t, handler, http.MethodPost, "/mecachis/metrics/ping", "10ms")       // +8, evicts mem
+	serve(t, handler, http.MethodGet, "/mecachis/metrics/ping", "")
+	serve(t, handler, http.MethodGet, "/mecachis/metrics/mem", "")
+
+	recorder := serve(t, exporter, http.MethodGet, "/metrics", "")
+	if recorder.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected content type. want '%s', have '%s'",
+			ContentType, recorder.Header().Get("Content-Type"))
+	}
+	body := recorder.Body.String()
+	wantLines := []string{
+		"# TYPE mecachis_hits_total counter",
+		`mecachis_hits_total{ns="metrics"} 1`,
+		`mecachis_misses_total{ns="metrics"} 1`,
+		`mecachis_inserts_total{ns="metrics"} 2`,
+		"# TYPE mecachis_bytes gauge",
+		`mecachis_bytes{ns="metrics"} 8`,
+		`mecachis_entries{ns="metrics"} 1`,
+		`mecachis_evictions_total{ns="metrics",reason="capacity"} 1`,
+		"# TYPE mecachis_http_request_duration_seconds histogram",
+		`mecachis_http_request_duration_seconds_count{method="POST",status="201"} 2`,
+		`mecachis_http_request_duration_seconds_count{method="GET",status="200"} 1`,
+		`mecachis_http_request_duration_seconds_count{method="GET",status="404"} 1`,
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected exposition to contain '%s', have:\n%s", line, body)
+		}
+	}
+}
+
+func TestExporter_Histogram(t *testing.T) {
+	exporter := NewExporter(mecachis.NewHub())
+	exporter.Observe(http.MethodGet, http.StatusOK, 2*time.Millisecond)
+	exporter.Observe(http.MethodGet, http.StatusOK, 2*time.Second)
+
+	var buf strings.Builder
+	if err := exporter.Write(&buf); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	body := buf.String()
+	wantLines := []string{
+		`mecachis_http_request_duration_seconds_bucket{method="GET",status="200",le="0.001"} 0`,
+		`mecachis_http_request_duration_seconds_bucket{method="GET",status="200",le="0.0025"} 1`,
+		`mecachis_http_request_duration_seconds_bucket{method="GET",status="200",le="1"} 1`,
+		`mecachis_http_request_duration_seconds_bucket{method="GET",status="200",le="+Inf"} 2`,
+		`mecachis_http_request_duration_seconds_sum{method="GET",status="200"} 2.002`,
+		`mecachis_http_request_duration_seconds_count{method="GET",status="200"} 2`,
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected exposition to contain '%s', have:\n%s", line, body)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if have := escape("a\"b\\c\nd"); have != `a\"b\\c\nd` {
+		t.Errorf("unexpected escaped label. have '%s'", have)
+	}
+}
@@ -0,0 +1,123 @@
+package mecachis
+
+import (
+	"fmt"
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"testing"
+)
+
+func TestCache_Pin(t *testing.T) {
+	// Keys of one byte and values of three take 4 bytes each, and up to 8
+	// of them may be pinned
+	c := NewCache(16, engines.LRU, WithMaxPinned(0.5))
+	_ = c.AddItem("a", &Item{Data: MemoryView("cfg"), Pinned: true})
+	_ = c.Add("b", MemoryView("cfg"))
+	if err := c.Pin("b"); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		_ = c.Add(fmt.Sprintf("%d", i), MemoryView("tmp"))
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("unexpected cache result. expected pinned '%s' to be kept", key)
+		}
+	}
+
+	_ = c.Add("c", MemoryView("cfg"))
+	if _, ok := c.Pin("c").(*ErrPinLimit); !ok {
+		t.Errorf("unexpected error. want ErrPinLimit")
+	}
+	err := c.AddItem("d", &Item{Data: MemoryView("cfg"), Pinned: true})
+	if _, ok := err.(*ErrPinLimit); !ok {
+		t.Errorf("unexpected error. want ErrPinLimit, have %v", err)
+	}
+	if _, ok := c.Get("d"); ok {
+		t.Errorf("unexpected cache result. expected 'd' not to be added")
+	}
+	if err := c.Pin("z"); err == nil {
+		t.Errorf("unexpected error. want ErrKeyNotFound, have nil")
+	}
+
+	// Replacing a key unpins it unless the new item is pinned too
+	_ = c.Set("a", MemoryView("new"))
+	if err := c.Unpin("b"); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		_ = c.Add(fmt.Sprintf("%d", i+10), MemoryView("tmp"))
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok := c.Get(key); ok {
+			t.Errorf("unexpected cache result. expected unpinned '%s' to be evicted", key)
+		}
+	}
+}
+
+func TestCache_Pin_RejectedKeepsPrevious(t *testing.T) {
+	c := NewCache(16, engines.LRU, WithMaxPinned(0.5))
+	_ = c.AddItem("a", &Item{Data: MemoryView("cfg"), Tags: []string{"config"}})
+	_, err := c.SetItem("a", &Item{Data: MemoryView("0123456789"), Pinned: true}, nil)
+	if _, ok := err.(*ErrPinLimit); !ok {
+		t.Fatalf("unexpected error. want ErrPinLimit, have %v", err)
+	}
+	if value, ok := c.Get("a"); !ok || value.String() != "cfg" {
+		t.Errorf("unexpected cache result. want 'cfg', have '%s'", value.String())
+	}
+	if n := c.InvalidateTag("config"); n != 1 {
+		t.Errorf("unexpected invalidated keys. want 1, have %d", n)
+	}
+
+	// Pinned keys are replaced by pinned items within the limit
+	_ = c.AddItem("b", &Item{Data: MemoryView("1234"), Pinned: true})
+	if _, err := c.SetItem("b", &Item{Data: MemoryView("4321"), Pinned: true}, nil); err != nil {
+		t.Errorf("unexpected error. want nil, have %v", err)
+	}
+}
+
+func TestCache_Pin_OnInsert(t *testing.T) {
+	// Making room for pinned items never evicts them, whatever the engine
+	for _, ct := range []engines.CacheType{engines.LRU, engines.LFU, engines.LFRU, engines.BLRU, engines.GDSF} {
+		c := NewCache(64, ct, WithMaxEntries(1), WithMaxPinned(1))
+		for _, key := range []string{"a", "b"} {
+			if err := c.AddItem(key, &Item{Data: MemoryView("cfg"), Pinned: true}); err != nil {
+				t.Fatalf("unexpected %s error. want nil, have %v", ct, err)
+			}
+		}
+		for _, key := range []string{"a", "b"} {
+			if info, ok := c.Inspect(key); !ok || !info.Pinned {
+				t.Errorf("unexpected %s cache result. expected '%s' to be kept pinned", ct, key)
+			}
+		}
+	}
+}
+
+func TestHub_ServeHTTP_Pin(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	recorder := conditionalRequest(hub, http.MethodPost, "/mecachis/config/flags?cap=64&maxpinned=0.25&pin", "on", nil)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code. want %d, have %d", http.StatusCreated, recorder.Code)
+	}
+	for i := 0; i < 20; i++ {
+		conditionalRequest(hub, http.MethodPost, fmt.Sprintf("/mecachis/config/tmp-%d", i), "value", nil)
+	}
+	recorder = conditionalRequest(hub, http.MethodHead, "/mecachis/config/flags", "", nil)
+	if recorder.Code != http.StatusOK || recorder.Header().Get(PinnedHeader) != "true" {
+		t.Errorf("unexpected response. want 200 and pinned, have %d and '%s'", recorder.Code, recorder.Header().Get(PinnedHeader))
+	}
+
+	// 16 bytes may be pinned, 7 of which are already
+	recorder = conditionalRequest(hub, http.MethodPut, "/mecachis/config/features?pin=true", "0123456789", nil)
+	if recorder.Code != http.StatusInsufficientStorage {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusInsufficientStorage, recorder.Code)
+	}
+	recorder = conditionalRequest(hub, http.MethodPut, "/mecachis/config/flags?pin=false", "off", nil)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("unexpected status code. want %d, have %d", http.StatusNoContent, recorder.Code)
+	}
+	recorder = conditionalRequest(hub, http.MethodHead, "/mecachis/config/flags", "", nil)
+	if have := recorder.Header().Get(PinnedHeader); have != "" {
+		t.Errorf("unexpected %s header. want none, have '%s'", PinnedHeader, have)
+	}
+}
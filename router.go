@@ -0,0 +1,225 @@
+package mecachis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxKeyLength is the maximum length in bytes of a key, once decoded
+	MaxKeyLength = 250
+	// reservedPrefix starts the names of hub endpoints and group actions, so
+	// that they never collide with namespaces
+	reservedPrefix = "_"
+)
+
+var nsPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+type ctxKey int
+
+const (
+	nsCtxKey ctxKey = iota
+	keyCtxKey
+)
+
+func nsFromContext(ctx context.Context) string {
+	ns, _ := ctx.Value(nsCtxKey).(string)
+	return ns
+}
+
+func keyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(keyCtxKey).(string)
+	return key
+}
+
+type handlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request)
+
+type routeKind int
+
+const (
+	// /mecachis/_{name}
+	hubRoute routeKind = iota
+	// /mecachis/{ns}
+	groupRoute
+	// /mecachis/{ns}/
+	listRoute
+	// /mecachis/{ns}/_{name}
+	actionRoute
+	// /mecachis/{ns}/{key}
+	keyRoute
+)
+
+type route struct {
+	kind    routeKind
+	method  string
+	name    string
+	handler handlerFunc
+}
+
+// target is what a request path addresses, once decoded
+type target struct {
+	ns     string
+	key    string
+	hasKey bool
+}
+
+// router dispatches requests under basePath to the handler registered for
+// the kind of resource the path addresses and the request method
+type router struct {
+	routes []route
+}
+
+func newRouter() *router {
+	return &router{}
+}
+
+func (rt *router) hub(method, name string, handler handlerFunc) {
+	rt.routes = append(rt.routes, route{kind: hubRoute, method: method, name: name, handler: handler})
+}
+
+func (rt *router) group(method string, handler handlerFunc) {
+	rt.routes = append(rt.routes, route{kind: groupRoute, method: method, handler: handler})
+}
+
+func (rt *router) list(method string, handler handlerFunc) {
+	rt.routes = append(rt.routes, route{kind: listRoute, method: method, handler: handler})
+}
+
+func (rt *router) action(method, name string, handler handlerFunc) {
+	rt.routes = append(rt.routes, route{kind: actionRoute, method: method, name: name, handler: handler})
+}
+
+func (rt *router) key(method string, handler handlerFunc) {
+	rt.routes = append(rt.routes, route{kind: keyRoute, method: method, handler: handler})
+}
+
+// errNotFound is returned by parseTarget for paths outside of basePath
+var errNotFound = errors.New("not found")
+
+func parseTarget(r *http.Request) (target, error) {
+	var t target
+	escaped := r.URL.EscapedPath()
+	if !strings.HasPrefix(escaped, basePath) {
+		return t, errNotFound
+	}
+	parts := strings.SplitN(escaped[len(basePath):], "/", 2)
+	ns, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return t, fmt.Errorf("malformed namespace: %v", err)
+	}
+	t.ns = ns
+	if len(parts) > 1 {
+		key, err := url.PathUnescape(parts[1])
+		if err != nil {
+			return t, fmt.Errorf("malformed key: %v", err)
+		}
+		t.key = key
+		t.hasKey = true
+	}
+	return t, nil
+}
+
+func validateNs(ns string) error {
+	if !nsPattern.MatchString(ns) {
+		return fmt.Errorf("invalid namespace '%s': must match %s", ns, nsPattern.String())
+	}
+	return nil
+}
+
+func validateKey(key string) error {
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("invalid key: longer than %d bytes", MaxKeyLength)
+	}
+	return nil
+}
+
+// match returns the routes the target path could be served by, regardless
+// of the method. Namespaces and keys are validated unless the target is a
+// hub endpoint
+func (rt *router) match(t target) ([]route, error) {
+	var kinds []routeKind
+	var name string
+	switch {
+	case !t.hasKey && strings.HasPrefix(t.ns, reservedPrefix):
+		kinds, name = []routeKind{hubRoute}, t.ns
+	case !t.hasKey:
+		kinds = []routeKind{groupRoute}
+	case t.key == "":
+		kinds = []routeKind{listRoute}
+	case strings.HasPrefix(t.key, reservedPrefix):
+		// Actions shadow keys only for the methods they are registered with
+		kinds, name = []routeKind{actionRoute, keyRoute}, t.key
+	default:
+		kinds = []routeKind{keyRoute}
+	}
+	var candidates []route
+	for _, kind := range kinds {
+		for _, r := range rt.routes {
+			if r.kind != kind || (kind == hubRoute || kind == actionRoute) && r.name != name {
+				continue
+			}
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) < 1 || candidates[0].kind == hubRoute {
+		return candidates, nil
+	}
+	if err := validateNs(t.ns); err != nil {
+		return nil, err
+	}
+	if t.hasKey {
+		if err := validateKey(t.key); err != nil {
+			return nil, err
+		}
+	}
+	return candidates, nil
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t, err := parseTarget(r)
+	if err == errNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	candidates, err := rt.match(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(candidates) < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	for _, candidate := range candidates {
+		if candidate.method != r.Method {
+			continue
+		}
+		ctx := context.WithValue(r.Context(), nsCtxKey, t.ns)
+		if candidate.kind == keyRoute {
+			ctx = context.WithValue(ctx, keyCtxKey, t.key)
+		}
+		candidate.handler(ctx, w, r.WithContext(ctx))
+		return
+	}
+	allowed := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		if !seen[candidate.method] {
+			seen[candidate.method] = true
+			allowed = append(allowed, candidate.method)
+		}
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,110 @@
+package mecachis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter_Validation(t *testing.T) {
+	tests := []testCase{
+		{
+			name:       "with an invalid namespace",
+			action:     &action{endpoint: "/mecachis/my%20app/key", method: http.MethodGet},
+			want:       "invalid namespace 'my app': must match " + nsPattern.String(),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "with a reserved namespace",
+			action:     &action{endpoint: "/mecachis/_app/key", method: http.MethodPost},
+			want:       "invalid namespace '_app': must match " + nsPattern.String(),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "with a too long key",
+			action: &action{
+				endpoint: "/mecachis/myapp/" + strings.Repeat("k", MaxKeyLength+1),
+				method:   http.MethodGet,
+			},
+			want:       "invalid key: longer than 250 bytes",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "with an unknown hub endpoint",
+			action:     &action{endpoint: "/mecachis/_unknown", method: http.MethodGet},
+			want:       "404 page not found",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "with a method not allowed on keys",
+			action:     &action{endpoint: "/mecachis/myapp/key", method: http.MethodPatch},
+			want:       "Method not allowed",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "with an url encoded key",
+			action:     &action{endpoint: "/mecachis/monitoring/sla%2Fp99%20latency", method: http.MethodGet},
+			want:       "perfdata: 100%",
+			wantStatus: http.StatusOK,
+			state:      &state{group: "monitoring", key: "sla/p99 latency", value: "perfdata: 100%"},
+		},
+		{
+			name:       "with a key named after an action",
+			action:     &action{endpoint: "/mecachis/monitoring/_mget", method: http.MethodGet},
+			want:       "perfdata: 100%",
+			wantStatus: http.StatusOK,
+			state:      &state{group: "monitoring", key: "_mget", value: "perfdata: 100%"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action := test.action
+			request := httptest.NewRequest(action.method, action.endpoint, strings.NewReader(action.payload))
+			responseRecorder := httptest.NewRecorder()
+
+			hub := NewHub(WithLogger(NopLogger()))
+			if test.state != nil {
+				g, _ := hub.getOrCreateGroup(test.state.group)
+				_ = g.Add(test.state.key, MemoryView(test.state.value))
+			}
+			hub.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d",
+					test.wantStatus, responseRecorder.Code)
+			}
+
+			cleanedBody := strings.TrimSpace(responseRecorder.Body.String())
+			if cleanedBody != test.want {
+				t.Errorf("unexpected response body. want '%s', have '%s'",
+					test.want, cleanedBody)
+			}
+		})
+	}
+}
+
+func TestRouter_MethodNotAllowed_Allow(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/mecachis/myapp", nil)
+	recorder := httptest.NewRecorder()
+	NewHub(WithLogger(NopLogger())).ServeHTTP(recorder, request)
+
+	if allow := recorder.Header().Get("Allow"); allow != "DELETE, GET, PUT" {
+		t.Errorf("unexpected Allow header. want 'DELETE, GET, PUT', have '%s'", allow)
+	}
+}
+
+func TestRouter_CanceledRequest(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodPost, "/mecachis/metrics/mem", strings.NewReader("13gb"))
+	hub.ServeHTTP(httptest.NewRecorder(), request.WithContext(ctx))
+
+	g, _ := hub.group("metrics")
+	if val, ok := g.Get("mem"); ok {
+		t.Errorf("unexpected cache result. expected nothing stored, have '%s'", val.String())
+	}
+}
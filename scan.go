@@ -0,0 +1,21 @@
+package mecachis
+
+const (
+	// DefaultScanCount is how many keys a page of a scan lists unless told
+	DefaultScanCount = 10
+	// MaxScanCount is how many keys a page of a scan lists at most
+	MaxScanCount = 1000
+)
+
+// ScannedKey is a key listed by a scan, along with the bytes it takes
+type ScannedKey struct {
+	Key  string `json:"key"`
+	Size uint64 `json:"size"`
+}
+
+// ScanResult is a page of a scan. Cursor resumes the scan, which is over
+// once it is empty
+type ScanResult struct {
+	Keys   []ScannedKey `json:"keys"`
+	Cursor string       `json:"cursor"`
+}
@@ -0,0 +1,116 @@
+package mecachis
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestShardedCache_Scan(t *testing.T) {
+	c := NewShardedCache(0, engines.LRU, 4)
+	for i := 0; i < 30; i++ {
+		_ = c.Add(fmt.Sprintf("key-%d", i), MemoryView("v"))
+	}
+	seen := make(map[string]int)
+	cursor := ""
+	for {
+		page, err := c.Scan(cursor, 4, "")
+		if err != nil {
+			t.Fatalf("unexpected error. want nil, have %v", err)
+		}
+		if len(page.Keys) > 4 {
+			t.Fatalf("unexpected page length. want at most 4, have %d", len(page.Keys))
+		}
+		for _, key := range page.Keys {
+			seen[key.Key]++
+		}
+		if cursor = page.Cursor; cursor == "" {
+			break
+		}
+	}
+	if len(seen) != 30 {
+		t.Errorf("unexpected keys scanned. want 30, have %d", len(seen))
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("unexpected times '%s' was scanned. want 1, have %d", key, n)
+		}
+	}
+}
+
+func TestCache_Scan(t *testing.T) {
+	c := NewCache(0, engines.LRU)
+	_ = c.Add("user:1", MemoryView("alice"))
+	_ = c.AddItem("user:2", &Item{Data: MemoryView("bob"), Expires: time.Now().Add(-time.Second)})
+	_ = c.Add("order:1", MemoryView("pending"))
+
+	page, err := c.Scan("", 10, "user:*")
+	if err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	want := []ScannedKey{{Key: "user:1", Size: uint64(len("user:1") + len("alice"))}}
+	if len(page.Keys) != 1 || page.Keys[0] != want[0] || page.Cursor != "" {
+		t.Errorf("unexpected page. want %v and no cursor, have %+v", want, page)
+	}
+	if _, err := c.Scan("", 10, "user:["); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
+
+func TestHub_ServeHTTP_Scan(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	for i := 0; i < 5; i++ {
+		conditionalRequest(hub, http.MethodPost, fmt.Sprintf("/mecachis/users/user:%d", i), "alice", nil)
+	}
+	conditionalRequest(hub, http.MethodPost, "/mecachis/users/admin:0", "bob", nil)
+
+	seen := make(map[string]uint64)
+	query := url.Values{"count": {"2"}, "match": {"user:*"}}
+	for pages := 1; ; pages++ {
+		recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/users/?"+query.Encode(), "", nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("unexpected status code. want %d, have %d", http.StatusOK, recorder.Code)
+		}
+		var page ScanResult
+		if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+			t.Fatalf("unexpected error. want nil, have %v", err)
+		}
+		for _, key := range page.Keys {
+			seen[key.Key] = key.Size
+		}
+		if page.Cursor == "" {
+			if pages != 3 {
+				t.Errorf("unexpected pages. want 3, have %d", pages)
+			}
+			break
+		}
+		query.Set("cursor", page.Cursor)
+	}
+	if len(seen) != 5 || seen["user:0"] != uint64(len("user:0")+len("alice")) {
+		t.Errorf("unexpected keys. want user:0 to user:4 with their sizes, have %v", seen)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		endpoint   string
+		wantStatus int
+	}{
+		{name: "malformed pattern", method: http.MethodGet, endpoint: "/mecachis/users/?match=%5B", wantStatus: http.StatusBadRequest},
+		{name: "count out of range", method: http.MethodGet, endpoint: "/mecachis/users/?count=0", wantStatus: http.StatusBadRequest},
+		{name: "non existent group", method: http.MethodGet, endpoint: "/mecachis/orders/", wantStatus: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPut, endpoint: "/mecachis/users/", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := conditionalRequest(hub, test.method, test.endpoint, "", nil)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d", test.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
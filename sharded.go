@@ -0,0 +1,226 @@
+package mecachis
+
+import (
+	e "github.com/sonirico/mecachis/engines"
+)
+
+// shardedCache spreads keys over several independent caches, each one with
+// its own engine and lock, so that operations on keys living in different
+// shards do not contend with each other
+type shardedCache struct {
+	shards []*cache
+}
+
+// NewShardedCache splits the capacity evenly among n shards, and so does
+// with the bound on entries, if any. Both are rounded up so that no shard
+// ends up with zero, which means unbounded
+func NewShardedCache(cap uint64, cType e.CacheType, n int, opts ...CacheOption) *shardedCache {
+	if n < 1 {
+		n = 1
+	}
+	opts = append(opts, func(c *cache) {
+		c.maxEntries = split(c.maxEntries, n)
+	})
+	shards := make([]*cache, n)
+	for i := range shards {
+		shards[i] = NewCache(split(cap, n), cType, opts...)
+	}
+	return &shardedCache{shards: shards}
+}
+
+// split returns the share of bound for each one of n shards, rounded up
+func split(bound uint64, n int) uint64 {
+	share := bound / uint64(n)
+	if bound%uint64(n) != 0 {
+		share++
+	}
+	return share
+}
+
+func (s *shardedCache) shardIndex(key string) int {
+	return int(e.HashKey(key) % uint32(len(s.shards)))
+}
+
+func (s *shardedCache) shard(key string) *cache {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *shardedCache) Add(key string, value MemoryView) error {
+	return s.shard(key).Add(key, value)
+}
+
+func (s *shardedCache) AddItem(key string, item *Item) error {
+	return s.shard(key).AddItem(key, item)
+}
+
+// AddMany groups pairs by shard so that each shard is locked only once
+func (s *shardedCache) AddMany(kvs []KeyValue) []error {
+	batches := make([][]KeyValue, len(s.shards))
+	positions := make([][]int, len(s.shards))
+	for i, kv := range kvs {
+		idx := s.shardIndex(kv.Key)
+		batches[idx] = append(batches[idx], kv)
+		positions[idx] = append(positions[idx], i)
+	}
+	errs := make([]error, len(kvs))
+	for idx, batch := range batches {
+		if len(batch) < 1 {
+			continue
+		}
+		for i, err := range s.shards[idx].AddMany(batch) {
+			errs[positions[idx][i]] = err
+		}
+	}
+	return errs
+}
+
+func (s *shardedCache) Set(key string, value MemoryView) error {
+	return s.shard(key).Set(key, value)
+}
+
+func (s *shardedCache) SetIf(key string, value MemoryView, cond Condition) error {
+	return s.shard(key).SetIf(key, value, cond)
+}
+
+func (s *shardedCache) SetItem(key string, item *Item, cond Condition) (*Item, error) {
+	return s.shard(key).SetItem(key, item, cond)
+}
+
+func (s *shardedCache) CompareAndSwap(key string, version uint64, value MemoryView) error {
+	return s.shard(key).CompareAndSwap(key, version, value)
+}
+
+func (s *shardedCache) Get(key string) (MemoryView, bool) {
+	return s.shard(key).Get(key)
+}
+
+// GetMany groups keys by shard so that each shard is locked only once
+func (s *shardedCache) GetMany(keys []string) map[string]MemoryView {
+	batches := make([][]string, len(s.shards))
+	for _, key := range keys {
+		idx := s.shardIndex(key)
+		batches[idx] = append(batches[idx], key)
+	}
+	result := make(map[string]MemoryView, len(keys))
+	for idx, batch := range batches {
+		if len(batch) < 1 {
+			continue
+		}
+		for key, value := range s.shards[idx].GetMany(batch) {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func (s *shardedCache) Lookup(key string) (*Item, bool) {
+	return s.shard(key).Lookup(key)
+}
+
+func (s *shardedCache) Peek(key string) (*Item, bool) {
+	return s.shard(key).Peek(key)
+}
+
+func (s *shardedCache) Inspect(key string) (KeyInfo, bool) {
+	return s.shard(key).Inspect(key)
+}
+
+func (s *shardedCache) Pin(key string) error {
+	return s.shard(key).Pin(key)
+}
+
+func (s *shardedCache) Unpin(key string) error {
+	return s.shard(key).Unpin(key)
+}
+
+func (s *shardedCache) Remove(key string) error {
+	return s.shard(key).Remove(key)
+}
+
+func (s *shardedCache) RemoveIf(key string, cond Condition) error {
+	return s.shard(key).RemoveIf(key, cond)
+}
+
+// Shrink evicts one entry at a time from the largest shard, so that shards
+// are kept even
+func (s *shardedCache) Shrink(size uint64) uint64 {
+	var freed uint64
+	exhausted := make([]bool, len(s.shards))
+	for freed < size {
+		largest := -1
+		var largestSize uint64
+		for i, shard := range s.shards {
+			if shardSize := shard.Size(); !exhausted[i] && (largest < 0 || shardSize > largestSize) {
+				largest, largestSize = i, shardSize
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		n := s.shards[largest].Shrink(1)
+		if n == 0 {
+			exhausted[largest] = true
+		}
+		freed += n
+	}
+	return freed
+}
+
+func (s *shardedCache) Size() uint64 {
+	var size uint64
+	for _, shard := range s.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+func (s *shardedCache) Stats() Stats {
+	var stats Stats
+	for _, shard := range s.shards {
+		stats.merge(shard.Stats())
+	}
+	return stats
+}
+
+// Scan goes through shards one after another. Cursors are keys, which
+// tell the shard to resume from
+func (s *shardedCache) Scan(cursor string, count int, pattern string) (ScanResult, error) {
+	result := ScanResult{Keys: make([]ScannedKey, 0)}
+	idx := 0
+	if cursor != "" {
+		idx = s.shardIndex(cursor)
+	}
+	for ; idx < len(s.shards) && len(result.Keys) < count; idx++ {
+		page, err := s.shards[idx].Scan(cursor, count-len(result.Keys), pattern)
+		if err != nil {
+			return ScanResult{}, err
+		}
+		result.Keys = append(result.Keys, page.Keys...)
+		if page.Cursor != "" {
+			result.Cursor = page.Cursor
+			return result, nil
+		}
+		cursor = ""
+	}
+	if idx < len(s.shards) && len(result.Keys) > 0 {
+		// The page is full, but the shards left are yet to be scanned
+		result.Cursor = result.Keys[len(result.Keys)-1].Key
+	}
+	return result, nil
+}
+
+func (s *shardedCache) InvalidateTag(tag string) int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += shard.InvalidateTag(tag)
+	}
+	return removed
+}
+
+func (s *shardedCache) InvalidatePrefix(prefix string) int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += shard.InvalidatePrefix(prefix)
+	}
+	return removed
+}
@@ -4,8 +4,6 @@ import "sync"
 
 type key string
 
-type callable func() (interface{}, error)
-
 type call struct {
 	wg  sync.WaitGroup
 	val interface{}
@@ -25,7 +23,10 @@ func New() *SingleCall {
 	}
 }
 
-func (sc *SingleCall) Run(k key, fn callable) (interface{}, error) {
+// Run calls fn unless a call for the same key is in flight already, in
+// which case it waits for it and returns its outcome instead
+func (sc *SingleCall) Run(name string, fn func() (interface{}, error)) (interface{}, error) {
+	k := key(name)
 	sc.l.Lock()
 	if c, ok := sc.calls[k]; ok {
 		sc.l.Unlock()
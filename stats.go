@@ -0,0 +1,124 @@
+package mecachis
+
+import (
+	"sync/atomic"
+)
+
+// EvictionReason tells why an entry left the cache
+type EvictionReason int
+
+const (
+	// EvictedCapacity means the engine made room for newer entries
+	EvictedCapacity EvictionReason = iota
+	// EvictedRemoved means the entry was explicitly removed
+	EvictedRemoved
+	// EvictedReplaced means the entry was overwritten by a newer value
+	EvictedReplaced
+	// EvictedExpired means the entry was dropped once past its expiry
+	EvictedExpired
+	// EvictedBudget means the entry was dropped to keep the hub within its
+	// memory budget
+	EvictedBudget
+
+	evictionReasons
+)
+
+var evictionReasonNames = [evictionReasons]string{
+	EvictedCapacity: "capacity",
+	EvictedRemoved:  "removed",
+	EvictedReplaced: "replaced",
+	EvictedExpired:  "expired",
+	EvictedBudget:   "budget",
+}
+
+func (r EvictionReason) String() string {
+	if r < 0 || r >= evictionReasons {
+		return "unknown"
+	}
+	return evictionReasonNames[r]
+}
+
+// Stats is a snapshot of the counters of a cache
+type Stats struct {
+	Hits             uint64            `json:"hits"`
+	Misses           uint64            `json:"misses"`
+	Inserts          uint64            `json:"inserts"`
+	DuplicateInserts uint64            `json:"duplicate_inserts"`
+	Evictions        map[string]uint64 `json:"evictions"`
+	Bytes            uint64            `json:"bytes"`
+	Entries          uint64            `json:"entries"`
+}
+
+// HitRate returns the ratio of lookups which found the key
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s *Stats) merge(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Inserts += other.Inserts
+	s.DuplicateInserts += other.DuplicateInserts
+	s.Bytes += other.Bytes
+	s.Entries += other.Entries
+	if s.Evictions == nil {
+		s.Evictions = make(map[string]uint64, len(other.Evictions))
+	}
+	for reason, count := range other.Evictions {
+		s.Evictions[reason] += count
+	}
+}
+
+// counters are updated atomically, as reads on concurrent engines happen
+// without holding the cache lock
+type counters struct {
+	hits             uint64
+	misses           uint64
+	inserts          uint64
+	duplicateInserts uint64
+	entries          int64
+	evictions        [evictionReasons]uint64
+}
+
+func (c *counters) hit() {
+	atomic.AddUint64(&c.hits, 1)
+}
+
+func (c *counters) miss() {
+	atomic.AddUint64(&c.misses, 1)
+}
+
+func (c *counters) insert(ok bool) {
+	if !ok {
+		atomic.AddUint64(&c.duplicateInserts, 1)
+		return
+	}
+	atomic.AddUint64(&c.inserts, 1)
+	atomic.AddInt64(&c.entries, 1)
+}
+
+func (c *counters) evict(reason EvictionReason) {
+	atomic.AddUint64(&c.evictions[reason], 1)
+	atomic.AddInt64(&c.entries, -1)
+}
+
+func (c *counters) snapshot() Stats {
+	stats := Stats{
+		Hits:             atomic.LoadUint64(&c.hits),
+		Misses:           atomic.LoadUint64(&c.misses),
+		Inserts:          atomic.LoadUint64(&c.inserts),
+		DuplicateInserts: atomic.LoadUint64(&c.duplicateInserts),
+		Evictions:        make(map[string]uint64, evictionReasons),
+	}
+	if entries := atomic.LoadInt64(&c.entries); entries > 0 {
+		stats.Entries = uint64(entries)
+	}
+	for reason := EvictionReason(0); reason < evictionReasons; reason++ {
+		stats.Evictions[reason.String()] = atomic.LoadUint64(&c.evictions[reason])
+	}
+	return stats
+}
@@ -0,0 +1,75 @@
+package mecachis
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TagsHeader carries the tags of a value, separated by commas, both when
+// it is written and when it is served
+const TagsHeader = "X-Mecachis-Tags"
+
+// invalidation is the reply of the invalidation endpoint
+type invalidation struct {
+	Invalidated int `json:"invalidated"`
+}
+
+// tagIndex maps tags to the keys cached with them, so that keys can be
+// invalidated by tag. Must be used with the lock of the cache held
+type tagIndex struct {
+	byTag map[string]map[string]struct{}
+	byKey map[string][]string
+}
+
+// set replaces the tags of key, returning the previous ones. Nil tags drop
+// the key from the index
+func (ti *tagIndex) set(key string, tags []string) []string {
+	previous := ti.byKey[key]
+	for _, tag := range previous {
+		keys := ti.byTag[tag]
+		delete(keys, key)
+		if len(keys) < 1 {
+			delete(ti.byTag, tag)
+		}
+	}
+	if len(tags) < 1 {
+		delete(ti.byKey, key)
+		return previous
+	}
+	if ti.byKey == nil {
+		ti.byKey = make(map[string][]string)
+		ti.byTag = make(map[string]map[string]struct{})
+	}
+	ti.byKey[key] = tags
+	for _, tag := range tags {
+		keys, ok := ti.byTag[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			ti.byTag[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return previous
+}
+
+// keys returns the keys tagged with tag
+func (ti *tagIndex) keys(tag string) []string {
+	keys := make([]string, 0, len(ti.byTag[tag]))
+	for key := range ti.byTag[tag] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// readTags returns the tags sent in the request, if any
+func readTags(r *http.Request) []string {
+	var tags []string
+	for _, header := range r.Header.Values(TagsHeader) {
+		for _, tag := range strings.Split(header, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
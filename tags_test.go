@@ -0,0 +1,154 @@
+package mecachis
+
+import (
+	"github.com/sonirico/mecachis/engines"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_InvalidateTag(t *testing.T) {
+	c := NewCache(0, engines.LRU)
+	_ = c.AddItem("user:1:header", &Item{Data: MemoryView("<h1>"), Tags: []string{"user:1"}})
+	_ = c.AddItem("user:1:footer", &Item{Data: MemoryView("<p>"), Tags: []string{"user:1", "footer"}})
+	_ = c.AddItem("user:2:footer", &Item{Data: MemoryView("<p>"), Tags: []string{"user:2", "footer"}})
+	// Duplicated inserts keep the tags of the cached item
+	_ = c.AddItem("user:2:footer", &Item{Data: MemoryView("<p>"), Tags: []string{"user:3"}})
+
+	if removed := c.InvalidateTag("user:3"); removed != 0 {
+		t.Errorf("unexpected invalidated keys. want 0, have %d", removed)
+	}
+	if removed := c.InvalidateTag("user:1"); removed != 2 {
+		t.Errorf("unexpected invalidated keys. want 2, have %d", removed)
+	}
+	if _, ok := c.Get("user:2:footer"); !ok {
+		t.Errorf("unexpected cache result. expected 'user:2:footer' to be kept")
+	}
+	keys := c.tags.keys("footer")
+	if !reflect.DeepEqual(keys, []string{"user:2:footer"}) {
+		t.Errorf("unexpected tagged keys. want [user:2:footer], have %v", keys)
+	}
+
+	// Replacing a value replaces its tags
+	_, _ = c.SetItem("user:2:footer", &Item{Data: MemoryView("<p>"), Tags: []string{"user:2"}}, nil)
+	if removed := c.InvalidateTag("footer"); removed != 0 {
+		t.Errorf("unexpected invalidated keys. want 0, have %d", removed)
+	}
+	if stats := c.Stats(); stats.Evictions["removed"] != 2 {
+		t.Errorf("unexpected removals. want 2, have %d", stats.Evictions["removed"])
+	}
+}
+
+func TestCache_Tags_Evictions(t *testing.T) {
+	// Every item takes 8 bytes of key, 4 of value and 6 of tag
+	c := NewCache(40, engines.LRU)
+	for _, key := range []string{"user:1:a", "user:1:b", "user:1:c"} {
+		_ = c.AddItem(key, &Item{Data: MemoryView("1234"), Tags: []string{"user:1"}})
+	}
+	keys := c.tags.keys("user:1")
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"user:1:b", "user:1:c"}) {
+		t.Errorf("unexpected tagged keys. want [user:1:b user:1:c], have %v", keys)
+	}
+
+	_ = c.Remove("user:1:b")
+	_ = c.AddItem("user:1:d", &Item{Data: MemoryView("1234"), Expires: time.Now().Add(-time.Second), Tags: []string{"user:1"}})
+	// Expired items are dropped, tags included, on the next write
+	_ = c.Add("user:1:d", MemoryView("1234"))
+	if keys := c.tags.keys("user:1"); !reflect.DeepEqual(keys, []string{"user:1:c"}) {
+		t.Errorf("unexpected tagged keys. want [user:1:c], have %v", keys)
+	}
+}
+
+func TestShardedCache_InvalidatePrefix(t *testing.T) {
+	c := NewShardedCache(0, engines.LRU, 4)
+	for _, key := range []string{"user:1:a", "user:1:b", "user:10:a", "user:2:a"} {
+		_ = c.Add(key, MemoryView("v"))
+	}
+	if removed := c.InvalidatePrefix("user:1:"); removed != 2 {
+		t.Errorf("unexpected invalidated keys. want 2, have %d", removed)
+	}
+	values := c.GetMany([]string{"user:1:a", "user:1:b", "user:10:a", "user:2:a"})
+	if len(values) != 2 {
+		t.Errorf("unexpected values. want user:10:a and user:2:a, have %v", values)
+	}
+}
+
+func TestHub_ServeHTTP_Invalidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		endpoint   string
+		want       string
+		wantStatus int
+		wantKept   []string
+	}{
+		{
+			name:       "by tag",
+			endpoint:   "/mecachis/fragments/_invalidate?tag=user:1",
+			want:       `{"invalidated":2}`,
+			wantStatus: http.StatusOK,
+			wantKept:   []string{"user:10:header"},
+		},
+		{
+			name:       "by prefix",
+			endpoint:   "/mecachis/fragments/_invalidate?prefix=user:1",
+			want:       `{"invalidated":3}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "without tag nor prefix",
+			endpoint:   "/mecachis/fragments/_invalidate",
+			want:       "either a tag or a prefix must be given",
+			wantStatus: http.StatusBadRequest,
+			wantKept:   []string{"user:10:header", "user:1:footer", "user:1:header"},
+		},
+		{
+			name:       "on a non existent group",
+			endpoint:   "/mecachis/pages/_invalidate?tag=user:1",
+			want:       "404 page not found",
+			wantStatus: http.StatusNotFound,
+			wantKept:   []string{"user:10:header", "user:1:footer", "user:1:header"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewHub(WithLogger(NopLogger()))
+			conditionalRequest(hub, http.MethodPost, "/mecachis/fragments/user:1:header", "<h1>",
+				map[string]string{TagsHeader: "user:1, header"})
+			conditionalRequest(hub, http.MethodPost, "/mecachis/fragments/user:1:footer", "<p>",
+				map[string]string{TagsHeader: "user:1"})
+			conditionalRequest(hub, http.MethodPost, "/mecachis/fragments/user:10:header", "<h1>",
+				map[string]string{TagsHeader: "user:10, header"})
+
+			recorder := conditionalRequest(hub, http.MethodPost, test.endpoint, "", nil)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("unexpected status code. want %d, have %d", test.wantStatus, recorder.Code)
+			}
+			if have := strings.TrimSpace(recorder.Body.String()); have != test.want {
+				t.Errorf("unexpected response body. want '%s', have '%s'", test.want, have)
+			}
+			g, _ := hub.group("fragments")
+			kept := make([]string, 0)
+			for key := range g.GetMany([]string{"user:1:footer", "user:1:header", "user:10:header"}) {
+				kept = append(kept, key)
+			}
+			sort.Strings(kept)
+			if len(kept) != len(test.wantKept) || len(kept) > 0 && !reflect.DeepEqual(kept, test.wantKept) {
+				t.Errorf("unexpected keys kept. want %v, have %v", test.wantKept, kept)
+			}
+		})
+	}
+}
+
+func TestHub_ServeHTTP_Get_Tags(t *testing.T) {
+	hub := NewHub(WithLogger(NopLogger()))
+	conditionalRequest(hub, http.MethodPost, "/mecachis/fragments/user:1:header", "<h1>",
+		map[string]string{TagsHeader: "user:1,header"})
+	recorder := conditionalRequest(hub, http.MethodGet, "/mecachis/fragments/user:1:header", "", nil)
+	if have := recorder.Header().Get(TagsHeader); have != "user:1, header" {
+		t.Errorf("unexpected %s header. want 'user:1, header', have '%s'", TagsHeader, have)
+	}
+}
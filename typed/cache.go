@@ -0,0 +1,214 @@
+// Package typed provides in-process caches holding values of any type, on
+// top of the same engines the hub uses, so that callers need neither type
+// assertions nor serialising values into bytes.
+package typed
+
+import (
+	"fmt"
+	"github.com/sonirico/mecachis"
+	"github.com/sonirico/mecachis/engines"
+	"strconv"
+	"sync"
+	"unsafe"
+)
+
+// Sizer returns how many bytes of capacity a value takes
+type Sizer[V any] func(value V) uint64
+
+// Keyer turns keys into the strings engines index entries by. Distinct
+// keys must map to distinct strings
+type Keyer[K comparable] func(key K) string
+
+// DefaultSizer returns the length of strings and byte slices and the
+// shallow size of any other value
+func DefaultSizer[V any](value V) uint64 {
+	switch v := any(value).(type) {
+	case string:
+		return uint64(len(v))
+	case []byte:
+		return uint64(len(v))
+	case mecachis.MemoryView:
+		return v.Len()
+	}
+	return uint64(unsafe.Sizeof(value))
+}
+
+// DefaultKeyer formats strings and integers the cheap way and any other key
+// in Go syntax, which tells apart values of the same type
+func DefaultKeyer[K comparable](key K) string {
+	switch k := any(key).(type) {
+	case string:
+		return k
+	case int:
+		return strconv.Itoa(k)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	}
+	return fmt.Sprintf("%#v", key)
+}
+
+// entry is what typed caches store in their engines
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  uint64
+}
+
+func (e *entry[K, V]) Value() interface{} {
+	return e.value
+}
+
+func (e *entry[K, V]) Len() uint64 {
+	return e.size
+}
+
+type Option[K comparable, V any] func(*Cache[K, V])
+
+// WithSizer replaces DefaultSizer
+func WithSizer[K comparable, V any](sizer Sizer[V]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.sizer = sizer
+	}
+}
+
+// WithKeyer replaces DefaultKeyer
+func WithKeyer[K comparable, V any](keyer Keyer[K]) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.keyer = keyer
+	}
+}
+
+// WithEvictionFn is called with every pair the engine evicts to make room
+// for new ones, with the lock of the cache held
+func WithEvictionFn[K comparable, V any](fn func(key K, value V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = fn
+	}
+}
+
+// Cache guards a single engine, like the caches of the hub do. It is safe
+// for concurrent use
+type Cache[K comparable, V any] struct {
+	mx sync.RWMutex
+
+	engine     engines.Engine
+	concurrent bool
+	capacity   uint64
+	sizer      Sizer[V]
+	keyer      Keyer[K]
+	onEvict    func(key K, value V)
+}
+
+// New returns a cache holding up to capacity bytes, as accounted by the
+// sizer plus the length of keys, once formatted by the keyer. Zero means
+// unbounded. Returns *mecachis.ErrUnsupportedEngine for cache types no
+// engine implements
+func New[K comparable, V any](capacity uint64, cType engines.CacheType, opts ...Option[K, V]) (*Cache[K, V], error) {
+	engine := mecachis.NewEngine(cType, capacity)
+	if engine == nil {
+		return nil, mecachis.NewUnsupportedEngineError(cType)
+	}
+	_, concurrent := engine.(engines.Concurrent)
+	c := &Cache[K, V]{
+		engine:     engine,
+		concurrent: concurrent,
+		capacity:   capacity,
+		sizer:      DefaultSizer[V],
+		keyer:      DefaultKeyer[K],
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	engine.OnEvict(c.evicted)
+	return c, nil
+}
+
+func (c *Cache[K, V]) evicted(evicted engines.Entry) {
+	if c.onEvict == nil {
+		return
+	}
+	e := evicted.Value().(*entry[K, V])
+	c.onEvict(e.key, e.value)
+}
+
+func (c *Cache[K, V]) lockRead() {
+	if !c.concurrent {
+		c.mx.Lock()
+	}
+}
+
+func (c *Cache[K, V]) unlockRead() {
+	if !c.concurrent {
+		c.mx.Unlock()
+	}
+}
+
+func (c *Cache[K, V]) newEntry(key K, value V) *entry[K, V] {
+	return &entry[K, V]{key: key, value: value, size: c.sizer(value)}
+}
+
+// fits tells whether the entry may be held at all under k
+func (c *Cache[K, V]) fits(k string, e *entry[K, V]) bool {
+	return c.capacity == 0 || uint64(len(k))+e.size <= c.capacity
+}
+
+// Add returns *mecachis.ErrDuplicatedKey if the key is cached already and
+// *mecachis.ErrTooLarge if the pair is larger than the capacity
+func (c *Cache[K, V]) Add(key K, value V) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	k := c.keyer(key)
+	e := c.newEntry(key, value)
+	if !c.fits(k, e) {
+		return mecachis.NewTooLargeError("'"+k+"'", c.capacity)
+	}
+	if !c.engine.Insert(k, e) {
+		return mecachis.NewDuplicatedKeyError(k)
+	}
+	return nil
+}
+
+// Set puts a key-value pair into the cache, replacing the previous value
+// if the key was cached already. Pairs larger than the capacity are not
+// cached, the previous value being kept
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	k := c.keyer(key)
+	e := c.newEntry(key, value)
+	if !c.fits(k, e) {
+		return
+	}
+	c.engine.Remove(k)
+	c.engine.Insert(k, e)
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.lockRead()
+	defer c.unlockRead()
+	res, ok := c.engine.Access(c.keyer(key))
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return res.(*entry[K, V]).value, true
+}
+
+// Remove returns *mecachis.ErrKeyNotFound if the key is not cached
+func (c *Cache[K, V]) Remove(key K) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	k := c.keyer(key)
+	if !c.engine.Remove(k) {
+		return mecachis.NewKeyNotFoundError(k)
+	}
+	return nil
+}
+
+func (c *Cache[K, V]) Size() uint64 {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.engine.Size()
+}
@@ -0,0 +1,138 @@
+package typed
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sonirico/mecachis"
+	"github.com/sonirico/mecachis/engines"
+	"sync"
+	"testing"
+)
+
+type host struct {
+	name string
+	port int
+}
+
+type usage struct {
+	cpu int
+	mem string
+}
+
+func TestCache_Get(t *testing.T) {
+	c, _ := New[host, usage](0, engines.LRU)
+	db := host{name: "db", port: 5432}
+	if err := c.Add(db, usage{cpu: 98, mem: "13gb"}); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var dup *mecachis.ErrDuplicatedKey
+	if err := c.Add(db, usage{}); !errors.As(err, &dup) {
+		t.Errorf("unexpected error. want ErrDuplicatedKey, have %v", err)
+	}
+	if value, ok := c.Get(db); !ok || value.cpu != 98 {
+		t.Errorf("unexpected cache result. want {98 13gb}, have %v", value)
+	}
+	if _, ok := c.Get(host{name: "db", port: 5433}); ok {
+		t.Errorf("unexpected cache result. want nothing for another port")
+	}
+
+	c.Set(db, usage{cpu: 12, mem: "2gb"})
+	if value, _ := c.Get(db); value.cpu != 12 {
+		t.Errorf("unexpected cache result. want {12 2gb}, have %v", value)
+	}
+	if err := c.Remove(db); err != nil {
+		t.Fatalf("unexpected error. want nil, have %v", err)
+	}
+	var notFound *mecachis.ErrKeyNotFound
+	if err := c.Remove(db); !errors.As(err, &notFound) {
+		t.Errorf("unexpected error. want ErrKeyNotFound, have %v", err)
+	}
+}
+
+func TestCache_Sizer_Eviction(t *testing.T) {
+	var evicted []int
+	c, _ := New[int, []float64](3*(1+16), engines.LRU,
+		WithSizer[int](func(series []float64) uint64 { return uint64(8 * len(series)) }),
+		WithEvictionFn(func(key int, _ []float64) { evicted = append(evicted, key) }),
+	)
+	for i := 1; i <= 4; i++ {
+		c.Set(i, []float64{float64(i), float64(i)})
+	}
+	if c.Size() != 3*(1+16) {
+		t.Errorf("unexpected cache size. want %d, have %d", 3*(1+16), c.Size())
+	}
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Errorf("unexpected evictions. want [1], have %v", evicted)
+	}
+	if _, ok := c.Get(1); ok {
+		t.Errorf("unexpected cache result. expected 1 to be evicted")
+	}
+}
+
+func TestCache_Oversized(t *testing.T) {
+	var evicted []string
+	c, _ := New[string, string](8, engines.LRU,
+		WithEvictionFn(func(key string, _ string) { evicted = append(evicted, key) }),
+	)
+	_ = c.Add("a", "1")
+	var tooLarge *mecachis.ErrTooLarge
+	if err := c.Add("b", "0123456789"); !errors.As(err, &tooLarge) {
+		t.Errorf("unexpected error. want ErrTooLarge, have %v", err)
+	}
+	c.Set("a", "0123456789")
+	if value, ok := c.Get("a"); !ok || value != "1" {
+		t.Errorf("unexpected cache result. want '1', have '%s'", value)
+	}
+	if len(evicted) != 0 {
+		t.Errorf("unexpected evictions. want none, have %v", evicted)
+	}
+}
+
+func TestNew_Unsupported(t *testing.T) {
+	var unsupported *mecachis.ErrUnsupportedEngine
+	if _, err := New[string, string](0, engines.MRU); !errors.As(err, &unsupported) {
+		t.Errorf("unexpected error. want ErrUnsupportedEngine, have %v", err)
+	}
+}
+
+func TestDefaultKeyer(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b interface{}
+	}{
+		{name: "strings", a: DefaultKeyer("a b"), b: DefaultKeyer("a")},
+		{name: "structs", a: DefaultKeyer(usage{cpu: 1, mem: "2, 3"}), b: DefaultKeyer(usage{cpu: 1, mem: "2"})},
+		{name: "arrays", a: DefaultKeyer([2]string{"a b", "c"}), b: DefaultKeyer([2]string{"a", "b c"})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.a == test.b {
+				t.Errorf("expected distinct keys. have '%s' for both", test.a)
+			}
+		})
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	for _, cType := range []engines.CacheType{engines.LRU, engines.BLRU} {
+		t.Run(cType.String(), func(t *testing.T) {
+			c, _ := New[string, int](512, cType)
+			var wg sync.WaitGroup
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 1000; i++ {
+						key := fmt.Sprintf("k%d", (w*i)%64)
+						if i%4 == 0 {
+							c.Set(key, i)
+							continue
+						}
+						c.Get(key)
+					}
+				}(w)
+			}
+			wg.Wait()
+		})
+	}
+}